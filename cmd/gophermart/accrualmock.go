@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/evgfitil/gophermart.git/internal/accrualmock"
+	"github.com/evgfitil/gophermart.git/internal/logger"
+)
+
+const (
+	defaultAccrualMockAddress = "localhost:8081"
+	defaultAccrualMockRules   = "*=100"
+)
+
+type accrualMockConfig struct {
+	Address       string
+	Rules         string
+	PendingPolls  int
+	Latency       time.Duration
+	RateLimitRate float64
+	RetryAfter    time.Duration
+	ErrorRate     float64
+}
+
+var (
+	accrualMockCfg accrualMockConfig
+	accrualMockCmd = &cobra.Command{
+		Use:   "accrual-mock",
+		Short: "Run a stand-in accrual system",
+		Long: `Runs a stand-in for the accrual system for local development and tests. It serves GET /api/orders/{number},
+moving every order matched by a rule through REGISTERED and PROCESSING to PROCESSED or INVALID.`,
+		Run: runAccrualMock,
+	}
+)
+
+func runAccrualMock(cmd *cobra.Command, args []string) {
+	logger.InitLogger(cfg.LogLevel)
+	defer logger.Sugar.Sync()
+
+	rules, err := accrualmock.ParseRules(accrualMockCfg.Rules)
+	if err != nil {
+		logger.Sugar.Fatalf("error parsing rules: %v", err)
+	}
+	mock := accrualmock.New(accrualmock.Config{
+		Rules:         rules,
+		PendingPolls:  accrualMockCfg.PendingPolls,
+		Latency:       accrualMockCfg.Latency,
+		RateLimitRate: accrualMockCfg.RateLimitRate,
+		RetryAfter:    accrualMockCfg.RetryAfter,
+		ErrorRate:     accrualMockCfg.ErrorRate,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: accrualMockCfg.Address, Handler: mock}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), defaultShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Sugar.Infof("starting accrual mock on %s", accrualMockCfg.Address)
+	if err = server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Sugar.Fatalf("error starting accrual mock: %v", err)
+	}
+}
+
+func init() {
+	flags := accrualMockCmd.Flags()
+	flags.StringVarP(&accrualMockCfg.Address, "address", "a", defaultAccrualMockAddress, "run address for the accrual mock in the format host:port")
+	flags.StringVar(&accrualMockCfg.Rules, "rules", defaultAccrualMockRules, "comma separated prefix=accrual reward rules, accrual may be \"invalid\" and prefix \"*\" matches every order")
+	flags.IntVar(&accrualMockCfg.PendingPolls, "pending-polls", 2, "requests answered with REGISTERED and PROCESSING before the final status")
+	flags.DurationVar(&accrualMockCfg.Latency, "latency", 0, "delay before every response")
+	flags.Float64Var(&accrualMockCfg.RateLimitRate, "rate-limit-rate", 0, "fraction of requests answered with 429")
+	flags.DurationVar(&accrualMockCfg.RetryAfter, "retry-after", time.Second, "Retry-After of 429 responses")
+	flags.Float64Var(&accrualMockCfg.ErrorRate, "error-rate", 0, "fraction of requests answered with 500")
+	rootCmd.AddCommand(accrualMockCmd)
+}
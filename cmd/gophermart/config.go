@@ -1,12 +1,267 @@
 package main
 
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/caarlos0/env/v10"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/ratelimit"
+)
+
+const (
+	configFileEnv  = "CONFIG_FILE"
+	redactedSecret = "xxxxx"
+)
+
+var (
+	logLevels = map[string]bool{"DEBUG": true, "INFO": true, "WARNING": true, "ERROR": true}
+	// dsnPassword matches the password of a keyword/value connection string
+	dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+)
+
+// Config is the configuration of the server. Every setting is taken from, in
+// increasing precedence, its flag default, the config file, the environment
+// and the flags set on the command line.
 type Config struct {
-	AccrualSystemAddress string `env:"ACCRUAL_SYSTEM_ADDRESS"`
-	LogLevel             string `env:"LOG_LEVEL" envDefault:"info"`
-	RunAddress           string `env:"RUN_ADDRESS"`
-	DatabaseURI          string `env:"DATABASE_URI"`
+	ConfigFile           string        `env:"CONFIG_FILE" yaml:"-" toml:"-"`
+	AccrualSystemAddress string        `env:"ACCRUAL_SYSTEM_ADDRESS" yaml:"accrual_system_address" toml:"accrual_system_address"`
+	AccrualTimeout       time.Duration `env:"ACCRUAL_TIMEOUT" yaml:"accrual_timeout" toml:"accrual_timeout"`
+	AccrualCAFile        string        `env:"ACCRUAL_CA_FILE" yaml:"accrual_ca_file" toml:"accrual_ca_file"`
+	AccrualInsecure      bool          `env:"ACCRUAL_INSECURE" yaml:"accrual_insecure" toml:"accrual_insecure"`
+	AccrualAuthHeader    string        `env:"ACCRUAL_AUTH_HEADER" yaml:"accrual_auth_header" toml:"accrual_auth_header"`
+	PollInterval         time.Duration `env:"POLL_INTERVAL" yaml:"poll_interval" toml:"poll_interval"`
+	OrderNotifications   string        `env:"ORDER_NOTIFICATIONS" yaml:"order_notifications" toml:"order_notifications"`
+	LeaderElection       bool          `env:"LEADER_ELECTION" yaml:"leader_election" toml:"leader_election"`
+	LeaderLease          time.Duration `env:"LEADER_LEASE" yaml:"leader_lease" toml:"leader_lease"`
+	InstanceID           string        `env:"INSTANCE_ID" yaml:"instance_id" toml:"instance_id"`
+	LogLevel             string        `env:"LOG_LEVEL" yaml:"log_level" toml:"log_level"`
+	RunAddress           string        `env:"RUN_ADDRESS" yaml:"run_address" toml:"run_address"`
+	MetricsAddress       string        `env:"METRICS_ADDRESS" yaml:"metrics_address" toml:"metrics_address"`
+	DatabaseURI          string        `env:"DATABASE_URI" yaml:"database_uri" toml:"database_uri"`
+	EventBus             string        `env:"EVENT_BUS" yaml:"event_bus" toml:"event_bus"`
+	EventBusFile         string        `env:"EVENT_BUS_FILE" yaml:"event_bus_file" toml:"event_bus_file"`
+	NATSURL              string        `env:"NATS_URL" yaml:"nats_url" toml:"nats_url"`
+	ShutdownTimeout      time.Duration `env:"SHUTDOWN_TIMEOUT" yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	ShutdownDelay        time.Duration `env:"SHUTDOWN_DELAY" yaml:"shutdown_delay" toml:"shutdown_delay"`
+	TracingExporter      string        `env:"TRACING_EXPORTER" yaml:"tracing_exporter" toml:"tracing_exporter"`
+	TracingEndpoint      string        `env:"TRACING_ENDPOINT" yaml:"tracing_endpoint" toml:"tracing_endpoint"`
+	TracingFile          string        `env:"TRACING_FILE" yaml:"tracing_file" toml:"tracing_file"`
+	RateLimits           string        `env:"RATE_LIMITS" yaml:"rate_limits" toml:"rate_limits"`
+	TrustedProxies       string        `env:"TRUSTED_PROXIES" yaml:"trusted_proxies" toml:"trusted_proxies"`
+	OpenAPIValidation    bool          `env:"OPENAPI_VALIDATION" yaml:"openapi_validation" toml:"openapi_validation"`
+	AdminToken           string        `env:"ADMIN_TOKEN" yaml:"admin_token" toml:"admin_token"`
 }
 
 func NewConfig() *Config {
 	return &Config{}
 }
+
+var (
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the server configuration",
+	}
+	configPrintCmd = &cobra.Command{
+		Use:   "print",
+		Short: "Print the effective server configuration",
+		Long: `Prints the configuration the server would run with, as YAML usable as a config file, with secrets redacted.
+It takes the same flags as the server and reads the same config file and environment. Problems found by the
+startup validation are reported after the configuration.`,
+		Run: runConfigPrint,
+	}
+)
+
+// loadConfig fills c, whose flags are registered in flags, from the config
+// file and the environment. Flags set on the command line are applied again
+// afterwards, so that they win over both.
+func loadConfig(c *Config, flags *pflag.FlagSet) error {
+	set := make(map[string]string)
+	flags.Visit(func(f *pflag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
+
+	if c.ConfigFile == "" {
+		c.ConfigFile = os.Getenv(configFileEnv)
+	}
+	if c.ConfigFile != "" {
+		if err := c.LoadFile(c.ConfigFile); err != nil {
+			return err
+		}
+	}
+	if err := env.Parse(c); err != nil {
+		return fmt.Errorf("error parsing environment: %w", err)
+	}
+	for name, value := range set {
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("error applying flag --%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// LoadFile overrides the settings present in a YAML or TOML file, told apart
+// by the extension. Unknown settings are rejected to catch typos.
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("error parsing config file %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("error parsing config file %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("error parsing config file %s: unknown settings %v", path, undecoded)
+		}
+	default:
+		return fmt.Errorf("config file %s must have a .yaml, .yml or .toml extension", path)
+	}
+	return nil
+}
+
+// Validate reports every setting the server cannot start with.
+func (c *Config) Validate() error {
+	errs := []error{c.ValidateDatabase()}
+	if _, _, err := net.SplitHostPort(c.RunAddress); err != nil {
+		errs = append(errs, fmt.Errorf("run address %q must be host:port: %w", c.RunAddress, err))
+	}
+	if c.MetricsAddress != "" {
+		if _, _, err := net.SplitHostPort(c.MetricsAddress); err != nil {
+			errs = append(errs, fmt.Errorf("metrics address %q must be host:port: %w", c.MetricsAddress, err))
+		}
+	}
+	errs = append(errs, validateURL("accrual system address", c.AccrualSystemAddress, "http", "https"))
+	if c.EventBus == "nats" {
+		errs = append(errs, validateURL("NATS URL", c.NATSURL, "nats", "tls"))
+	}
+	errs = append(errs, validateURL("tracing endpoint", c.TracingEndpoint, "http", "https"))
+	errs = append(errs,
+		validatePositive("poll interval", c.PollInterval),
+		validatePositive("accrual timeout", c.AccrualTimeout),
+		validatePositive("shutdown timeout", c.ShutdownTimeout),
+	)
+	if c.LeaderElection {
+		errs = append(errs, validatePositive("leader lease", c.LeaderLease))
+	}
+	if c.ShutdownDelay < 0 {
+		errs = append(errs, fmt.Errorf("shutdown delay must not be negative, got %v", c.ShutdownDelay))
+	}
+	if _, err := ratelimit.ParseTrustedProxies(c.TrustedProxies); err != nil {
+		errs = append(errs, err)
+	}
+	if !logLevels[strings.ToUpper(c.LogLevel)] {
+		errs = append(errs, fmt.Errorf("log level must be DEBUG, INFO, WARNING or ERROR, got %q", c.LogLevel))
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateDatabase reports whether the commands that only work on the
+// database, such as orders reprocess, can run.
+func (c *Config) ValidateDatabase() error {
+	if c.DatabaseURI == "" {
+		return errors.New("database URI is required")
+	}
+	return nil
+}
+
+// validateURL checks that value, if set, is an absolute URL with one of
+// schemes.
+func validateURL(name string, value string, schemes ...string) error {
+	if value == "" {
+		return nil
+	}
+	// the parse error quotes the URL, which may carry a password
+	u, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid URL", name)
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme && u.Host != "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s %q must be an absolute %s URL", name, redactURL(value), strings.Join(schemes, " or "))
+}
+
+func validatePositive(name string, d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("%s must be positive, got %v", name, d)
+	}
+	return nil
+}
+
+// Redacted returns a copy of c with passwords and tokens masked.
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redacted.DatabaseURI = redactURL(c.DatabaseURI)
+	redacted.NATSURL = redactURL(c.NATSURL)
+	if c.AccrualAuthHeader != "" {
+		redacted.AccrualAuthHeader = redactedSecret
+	}
+	if c.AdminToken != "" {
+		redacted.AdminToken = redactedSecret
+	}
+	return &redacted
+}
+
+// redactURL masks the password of a URL or of a keyword/value connection
+// string.
+func redactURL(value string) string {
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" {
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(value, "${1}"+redactedSecret)
+}
+
+func runConfigPrint(cmd *cobra.Command, args []string) {
+	err := loadConfig(cfg, cmd.Flags())
+	logger.InitLogger(cfg.LogLevel)
+	defer logger.Sugar.Sync()
+	if err != nil {
+		logger.Sugar.Fatalf("error loading config: %v", err)
+	}
+
+	out := cmd.OutOrStdout()
+	if cfg.ConfigFile != "" {
+		fmt.Fprintf(out, "# config file: %s\n", cfg.ConfigFile)
+	}
+	encoder := yaml.NewEncoder(out)
+	if err = encoder.Encode(cfg.Redacted()); err != nil {
+		logger.Sugar.Fatalf("error printing config: %v", err)
+	}
+	encoder.Close()
+
+	if err = cfg.Validate(); err != nil {
+		logger.Sugar.Fatalf("invalid config: %v", err)
+	}
+}
+
+func init() {
+	registerServerFlags(configPrintCmd.Flags(), cfg)
+	configCmd.AddCommand(configPrintCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+// parseConfig loads a config the way the server does with args on the
+// command line.
+func parseConfig(t *testing.T, args ...string) (*Config, error) {
+	t.Helper()
+	c := NewConfig()
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	registerServerFlags(flags, c)
+	require.NoError(t, flags.Parse(args))
+	return c, loadConfig(c, flags)
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "gophermart.yaml", `
+database_uri: postgres://app:secret@db/gophermart
+poll_interval: 30s
+leader_lease: 20s
+shutdown_delay: 5s
+`)
+	t.Setenv("POLL_INTERVAL", "20s")
+	t.Setenv("LEADER_LEASE", "25s")
+
+	c, err := parseConfig(t, "--config", path, "--poll-interval", "5s")
+	require.NoError(t, err)
+	// flags win over the environment, which wins over the file, which wins
+	// over the defaults
+	assert.Equal(t, 5*time.Second, c.PollInterval)
+	assert.Equal(t, 25*time.Second, c.LeaderLease)
+	assert.Equal(t, 5*time.Second, c.ShutdownDelay)
+	assert.Equal(t, defaultShutdownTimeout, c.ShutdownTimeout)
+	assert.Equal(t, "postgres://app:secret@db/gophermart", c.DatabaseURI)
+	assert.NoError(t, c.Validate())
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr bool
+	}{
+		{
+			name:    "toml",
+			file:    "gophermart.toml",
+			content: "database_uri = \"postgres://db/gophermart\"\npoll_interval = \"30s\"\n",
+		},
+		{
+			name:    "unknown yaml setting",
+			file:    "gophermart.yaml",
+			content: "database_uri: postgres://db/gophermart\npoll_intervall: 30s\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown toml setting",
+			file:    "gophermart.toml",
+			content: "database_url = \"postgres://db/gophermart\"\n",
+			wantErr: true,
+		},
+		{
+			name:    "malformed duration",
+			file:    "gophermart.yaml",
+			content: "poll_interval: often\n",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported format",
+			file:    "gophermart.json",
+			content: "{}",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(configFileEnv, writeConfigFile(t, tt.file, tt.content))
+
+			c, err := parseConfig(t)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "postgres://db/gophermart", c.DatabaseURI)
+			assert.Equal(t, 30*time.Second, c.PollInterval)
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			args: []string{"-d", "postgres://db/gophermart", "-r", "http://accrual:8080"},
+		},
+		{
+			name:    "missing database URI",
+			wantErr: "database URI is required",
+		},
+		{
+			name:    "accrual address without scheme",
+			args:    []string{"-d", "postgres://db/gophermart", "-r", "localhost:8081"},
+			wantErr: "accrual system address",
+		},
+		{
+			name:    "metrics address without port",
+			args:    []string{"-d", "postgres://db/gophermart", "--metrics-address", "localhost"},
+			wantErr: "metrics address",
+		},
+		{
+			name:    "trusted proxy that is not an address",
+			args:    []string{"-d", "postgres://db/gophermart", "--trusted-proxies", "proxy.internal"},
+			wantErr: "trusted proxy",
+		},
+		{
+			name:    "zero poll interval",
+			args:    []string{"-d", "postgres://db/gophermart", "--poll-interval", "0s"},
+			wantErr: "poll interval must be positive",
+		},
+		{
+			name:    "unknown log level",
+			args:    []string{"-d", "postgres://db/gophermart", "--log-level", "verbose"},
+			wantErr: "log level",
+		},
+		{
+			name:    "NATS URL with the nats event bus",
+			args:    []string{"-d", "postgres://db/gophermart", "--event-bus", "nats", "--nats-url", "http://nats:4222"},
+			wantErr: "NATS URL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseConfig(t, tt.args...)
+			require.NoError(t, err)
+
+			err = c.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestConfigValidateDatabase(t *testing.T) {
+	c := &Config{DatabaseURI: "postgres://db/gophermart"}
+	assert.NoError(t, c.ValidateDatabase())
+	assert.Error(t, c.Validate(), "the server settings are left unset")
+
+	c.DatabaseURI = ""
+	assert.EqualError(t, c.ValidateDatabase(), "database URI is required")
+}
+
+func TestConfigRedacted(t *testing.T) {
+	c := &Config{
+		DatabaseURI:       "postgres://app:secret@db/gophermart",
+		NATSURL:           "nats://nats:4222",
+		AccrualAuthHeader: "Bearer secret",
+		AdminToken:        "secret",
+	}
+	redacted := c.Redacted()
+	assert.Equal(t, "postgres://app:xxxxx@db/gophermart", redacted.DatabaseURI)
+	assert.Equal(t, "nats://nats:4222", redacted.NATSURL)
+	assert.Equal(t, redactedSecret, redacted.AccrualAuthHeader)
+	assert.Equal(t, redactedSecret, redacted.AdminToken)
+	assert.Equal(t, "secret", c.AdminToken, "the config itself is left as it is")
+
+	c.DatabaseURI = "host=db user=app password='se cret' dbname=gophermart"
+	assert.Equal(t, "host=db user=app password=xxxxx dbname=gophermart", c.Redacted().DatabaseURI)
+}
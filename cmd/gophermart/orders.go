@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/evgfitil/gophermart.git/internal/database"
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+const reprocessDateLayout = "2006-01-02"
+
+var orderStatuses = map[string]bool{
+	models.OrderStatusNew:        true,
+	models.OrderStatusProcessing: true,
+	models.OrderStatusInvalid:    true,
+	models.OrderStatusProcessed:  true,
+}
+
+type reprocessConfig struct {
+	Statuses []string
+	From     string
+	To       string
+	User     string
+	Orders   []string
+	DryRun   bool
+	Correct  bool
+}
+
+var (
+	reprocessCfg reprocessConfig
+	ordersCmd    = &cobra.Command{
+		Use:   "orders",
+		Short: "Manage orders",
+	}
+	reprocessCmd = &cobra.Command{
+		Use:   "reprocess",
+		Short: "Check selected orders with the accrual system again",
+		Long: `Makes the selected orders due for a check by the loyalty processor again, for example after the accrual
+system fixed a bug. Unfinished and dead-lettered orders get fresh attempts, invalid orders start over as NEW and
+processed orders are rechecked. A changed accrual of a processed order is only reported unless --correct is set,
+then the difference is posted to the ledger as a correction. Prints the selected orders and what is done with them.`,
+		Run: runReprocess,
+	}
+)
+
+// orderFilter builds the order filter from the reprocess flags.
+func (c reprocessConfig) orderFilter() (models.OrderFilter, error) {
+	filter := models.OrderFilter{Username: c.User, Numbers: c.Orders}
+	for _, status := range c.Statuses {
+		status = strings.ToUpper(status)
+		if !orderStatuses[status] {
+			return filter, fmt.Errorf("unknown order status %q", status)
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+
+	var err error
+	if filter.From, err = parseReprocessDate(c.From); err != nil {
+		return filter, fmt.Errorf("invalid --from: %w", err)
+	}
+	if filter.To, err = parseReprocessDate(c.To); err != nil {
+		return filter, fmt.Errorf("invalid --to: %w", err)
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, errors.New("--from must be before --to")
+	}
+
+	if len(filter.Statuses) == 0 && filter.From.IsZero() && filter.To.IsZero() && filter.Username == "" && len(filter.Numbers) == 0 {
+		return filter, errors.New("at least one of --status, --from, --to, --user or --order is required")
+	}
+	return filter, nil
+}
+
+// parseReprocessDate accepts a date, taken as midnight UTC, or an RFC 3339
+// timestamp. An empty value is the zero time.
+func parseReprocessDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(reprocessDateLayout, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func runReprocess(cmd *cobra.Command, args []string) {
+	err := loadConfig(cfg, cmd.Flags())
+	logger.InitLogger(cfg.LogLevel)
+	defer logger.Sugar.Sync()
+	if err != nil {
+		logger.Sugar.Fatalf("error loading config: %v", err)
+	}
+	// the server settings are not used here and mostly have no flags
+	if err = cfg.ValidateDatabase(); err != nil {
+		logger.Sugar.Fatalf("invalid config: %v", err)
+	}
+	filter, err := reprocessCfg.orderFilter()
+	if err != nil {
+		logger.Sugar.Fatalf("error selecting orders: %v", err)
+	}
+
+	db, err := database.NewDBStorage(cfg.DatabaseURI)
+	if err != nil {
+		logger.Sugar.Fatalf("error connecting to database: %v", err)
+	}
+	defer db.Close()
+
+	orders, err := db.ReprocessOrders(context.Background(), filter, reprocessCfg.Correct, reprocessCfg.DryRun)
+	if err != nil {
+		logger.Sugar.Fatalf("error reprocessing orders: %v", err)
+	}
+	if err = writeReprocessReport(cmd.OutOrStdout(), orders, reprocessCfg.DryRun); err != nil {
+		logger.Sugar.Fatalf("error writing report: %v", err)
+	}
+}
+
+func writeReprocessReport(out io.Writer, orders []models.ReprocessedOrder, dryRun bool) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ORDER\tUSER\tSTATUS\tACCRUAL\tACTION")
+	actions := make(map[string]int)
+	for _, order := range orders {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.2f\t%s\n", order.OrderNumber, order.Username, order.Status, order.Accrual, order.Action)
+		actions[order.Action]++
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	verb := "reprocessed"
+	if dryRun {
+		verb = "would be reprocessed (dry run)"
+	}
+	_, err := fmt.Fprintf(out, "\n%d orders %s: %d requeued, %d rechecked, %d rechecked with corrections\n",
+		len(orders), verb,
+		actions[models.ReprocessActionRequeue], actions[models.ReprocessActionRecheck], actions[models.ReprocessActionCorrect])
+	return err
+}
+
+func init() {
+	flags := reprocessCmd.Flags()
+	flags.StringVarP(&cfg.ConfigFile, "config", "c", "", "YAML or TOML config file of the server, overridden by the environment and flags")
+	flags.StringVarP(&cfg.DatabaseURI, "database-uri", "d", "", "database connection string")
+	flags.StringSliceVar(&reprocessCfg.Statuses, "status", nil, "order statuses to select: NEW, PROCESSING, INVALID or PROCESSED")
+	flags.StringVar(&reprocessCfg.From, "from", "", "select orders uploaded at or after this date (2006-01-02) or RFC 3339 time")
+	flags.StringVar(&reprocessCfg.To, "to", "", "select orders uploaded before this date (2006-01-02) or RFC 3339 time")
+	flags.StringVar(&reprocessCfg.User, "user", "", "select orders of this login")
+	flags.StringSliceVar(&reprocessCfg.Orders, "order", nil, "order numbers to select")
+	flags.BoolVar(&reprocessCfg.DryRun, "dry-run", false, "only report the selected orders")
+	flags.BoolVar(&reprocessCfg.Correct, "correct", false, "post corrections to the ledger for processed orders whose accrual changed")
+	ordersCmd.AddCommand(reprocessCmd)
+	rootCmd.AddCommand(ordersCmd)
+}
@@ -2,27 +2,61 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/caarlos0/env/v10"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
+	"github.com/evgfitil/gophermart.git/internal/accrual"
 	"github.com/evgfitil/gophermart.git/internal/api"
 	"github.com/evgfitil/gophermart.git/internal/database"
+	"github.com/evgfitil/gophermart.git/internal/health"
 	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/metrics"
+	"github.com/evgfitil/gophermart.git/internal/publisher"
+	"github.com/evgfitil/gophermart.git/internal/ratelimit"
+	"github.com/evgfitil/gophermart.git/internal/scheduler"
 	"github.com/evgfitil/gophermart.git/internal/services"
+	"github.com/evgfitil/gophermart.git/internal/tracing"
 )
 
 const (
-	defaultRunAddress = "localhost:8080"
+	defaultRunAddress      = "localhost:8080"
+	defaultMetricsAddress  = "localhost:9090"
+	defaultLogLevel        = "INFO"
+	defaultEventBusFile    = "gophermart-events.jsonl"
+	defaultNATSURL         = "nats://localhost:4222"
+	defaultTracingFile     = "gophermart-traces.jsonl"
+	defaultRateLimits      = "register=10/1m,login=20/1m,orders_upload=60/1m,withdraw=30/1m"
+	defaultShutdownTimeout = 20 * time.Second
+	defaultAccrualTimeout  = 10 * time.Second
+	defaultPollInterval    = 10 * time.Second
+	defaultLeaderLease     = 15 * time.Second
+	leaderElectionName     = "jobs"
+	accrualPollTimeout     = 2 * time.Minute
+	jobRunsCleanupSchedule = "@hourly"
+	jobRunsRetention       = 7 * 24 * time.Hour
+	ledgerMetricsInterval  = time.Minute
+	webhookDispatchPeriod  = 5 * time.Second
+	outboxRelayPeriod      = time.Second
+	// idempotencyKeysRetention matches how long the API replays a response
+	idempotencyKeysRetention = 24 * time.Hour
+	// outboxRetention keeps delivered events and their webhook deliveries
+	// readable for as long as the job runs
+	outboxRetention = 7 * 24 * time.Hour
+	orderQueueSize  = 1024
 )
 
 var (
-	cfg     *Config
+	cfg     = NewConfig()
 	rootCmd = &cobra.Command{
 		Use:   "server",
 		Short: "Gophermart Loyalty System",
@@ -33,12 +67,171 @@ var (
 	}
 )
 
+// newPublisher returns the event bus publisher selected by cfg.EventBus or nil
+// when publishing is disabled.
+func newPublisher(cfg *Config) (services.Publisher, error) {
+	switch cfg.EventBus {
+	case "":
+		return nil, nil
+	case "nats":
+		return publisher.NewNATSPublisher(cfg.NATSURL)
+	case "file":
+		return publisher.NewFilePublisher(cfg.EventBusFile)
+	case "memory":
+		return publisher.NewMemoryPublisher(), nil
+	default:
+		return nil, fmt.Errorf("unknown event bus %q", cfg.EventBus)
+	}
+}
+
+// instanceID returns the name this instance campaigns for leadership under,
+// the host name and process ID unless cfg.InstanceID is set.
+func instanceID(cfg *Config) string {
+	if cfg.InstanceID != "" {
+		return cfg.InstanceID
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "gophermart"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// newScheduler returns the job scheduler with the periodic jobs: the accrual
+// poll, which sweeps unfinished orders, the refresh of the ledger metrics and
+// the cleanup of old job runs, expired idempotency keys and delivered outbox
+// events. eventBus tells whether events must be published before they are
+// deleted.
+func newScheduler(cfg *Config, db *database.DBStorage, lps *services.LoyaltyProcessorService, eventBus bool) (*scheduler.Scheduler, error) {
+	sched := scheduler.New(db, instanceID(cfg))
+	err := sched.Add(scheduler.Job{
+		Name:     "accrual_poll",
+		Schedule: scheduler.Every(cfg.PollInterval),
+		Jitter:   cfg.PollInterval / 10,
+		Timeout:  accrualPollTimeout,
+		Run:      lps.Poll,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = sched.Add(scheduler.Job{
+		Name:     "ledger_metrics",
+		Schedule: scheduler.Every(ledgerMetricsInterval),
+		Jitter:   ledgerMetricsInterval / 10,
+		Run: func(ctx context.Context) error {
+			return metrics.RefreshLedger(ctx, db)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cleanupSchedule, err := scheduler.Cron(jobRunsCleanupSchedule)
+	if err != nil {
+		return nil, err
+	}
+	err = sched.Add(scheduler.Job{
+		Name:     "job_runs_cleanup",
+		Schedule: cleanupSchedule,
+		Jitter:   time.Minute,
+		Run: func(ctx context.Context) error {
+			deleted, err := db.DeleteJobRunsBefore(ctx, time.Now().Add(-jobRunsRetention))
+			if err != nil {
+				return err
+			}
+			logger.FromContext(ctx).Infof("deleted %d old job runs", deleted)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = sched.Add(scheduler.Job{
+		Name:     "idempotency_keys_cleanup",
+		Schedule: cleanupSchedule,
+		Jitter:   time.Minute,
+		Run: func(ctx context.Context) error {
+			deleted, err := db.DeleteIdempotencyKeysBefore(ctx, time.Now().Add(-idempotencyKeysRetention))
+			if err != nil {
+				return err
+			}
+			logger.FromContext(ctx).Infof("deleted %d expired idempotency keys", deleted)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = sched.Add(scheduler.Job{
+		Name:     "outbox_cleanup",
+		Schedule: cleanupSchedule,
+		Jitter:   time.Minute,
+		Run: func(ctx context.Context) error {
+			deleted, err := db.DeleteOutboxEventsBefore(ctx, time.Now().Add(-outboxRetention), eventBus)
+			if err != nil {
+				return err
+			}
+			logger.FromContext(ctx).Infof("deleted %d delivered outbox events", deleted)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sched, nil
+}
+
+func newAccrualClient(cfg *Config) (*accrual.HTTPClient, error) {
+	var headers map[string]string
+	if cfg.AccrualAuthHeader != "" {
+		headers = map[string]string{"Authorization": cfg.AccrualAuthHeader}
+	}
+	return accrual.NewHTTPClient(cfg.AccrualSystemAddress, accrual.Config{
+		Timeout:            cfg.AccrualTimeout,
+		CAFile:             cfg.AccrualCAFile,
+		InsecureSkipVerify: cfg.AccrualInsecure,
+		Headers:            headers,
+	})
+}
+
+// newOrderListener returns the listener announcing uploaded orders selected
+// by cfg.OrderNotifications, nil when uploaded orders wait for polling, and
+// the order storage for the API, which feeds the in-process queue.
+func newOrderListener(cfg *Config, db *database.DBStorage) (services.NewOrderListener, services.OrderStorage, error) {
+	switch cfg.OrderNotifications {
+	case "":
+		return nil, db, nil
+	case "postgres":
+		return db, db, nil
+	case "memory":
+		queue := services.NewOrderQueue(orderQueueSize)
+		return queue, queue.OrderStorage(db), nil
+	default:
+		return nil, nil, fmt.Errorf("unknown order notifications %q", cfg.OrderNotifications)
+	}
+}
+
 func runServer(cmd *cobra.Command, args []string) {
+	// the log level is part of the config, errors loading it are logged at
+	// the default level
+	err := loadConfig(cfg, cmd.Flags())
 	logger.InitLogger(cfg.LogLevel)
 	defer logger.Sugar.Sync()
+	if err != nil {
+		logger.Sugar.Fatalf("error loading config: %v", err)
+	}
+	if err = cfg.Validate(); err != nil {
+		logger.Sugar.Fatalf("invalid config: %v", err)
+	}
 
-	if err := env.Parse(cfg); err != nil {
-		logger.Sugar.Fatalf("error parsing config: %v", err)
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter: cfg.TracingExporter,
+		Endpoint: cfg.TracingEndpoint,
+		File:     cfg.TracingFile,
+	})
+	if err != nil {
+		logger.Sugar.Fatalf("error setting up tracing: %v", err)
 	}
 
 	db, err := database.NewDBStorage(cfg.DatabaseURI)
@@ -47,26 +240,201 @@ func runServer(cmd *cobra.Command, args []string) {
 	}
 
 	userStorage := db
-	orderStorage := db
 	balanceStorage := db
-	loyaltyProcessor := services.NewLoyaltyProcessorService(cfg.AccrualSystemAddress, orderStorage)
+	accrualClient, err := newAccrualClient(cfg)
+	if err != nil {
+		logger.Sugar.Fatalf("error creating accrual client: %v", err)
+	}
+	orderListener, orderStorage, err := newOrderListener(cfg, db)
+	if err != nil {
+		logger.Sugar.Fatalf("error creating order listener: %v", err)
+	}
+	loyaltyProcessor := services.NewLoyaltyProcessorService(accrualClient, db, orderListener)
+	eventBroker := services.NewEventBroker(db)
+	webhookStorage := db
+	idempotencyStorage := db
+	webhookDispatcher := services.NewWebhookDispatcher(webhookStorage)
+
+	eventPublisher, err := newPublisher(cfg)
+	if err != nil {
+		logger.Sugar.Fatalf("error creating event bus publisher: %v", err)
+	}
+	var outboxRelay *services.OutboxRelay
+	if eventPublisher != nil {
+		outboxStorage := db
+		outboxRelay = services.NewOutboxRelay(outboxStorage, eventPublisher)
+	}
+
+	healthService := health.NewService()
+	healthService.Register("database", func(ctx context.Context) (map[string]any, error) {
+		return nil, db.Ping(ctx)
+	})
+	healthService.Register("migrations", db.CheckMigrations)
+	healthService.RegisterInformational("accrual", loyaltyProcessor.CheckAccrualService)
+	healthService.RegisterInformational("accrual_circuit", loyaltyProcessor.CheckCircuitBreaker)
+	jobScheduler, err := newScheduler(cfg, db, loyaltyProcessor, eventPublisher != nil)
+	if err != nil {
+		logger.Sugar.Fatalf("error creating job scheduler: %v", err)
+	}
+	healthService.RegisterInformational("jobs", jobScheduler.CheckJobs)
+
+	// jobs that must run on one instance only are started by the leader
+	var leaderElector *services.LeaderElector
+	if cfg.LeaderElection {
+		leaderElector = services.NewLeaderElector(db, leaderElectionName, instanceID(cfg), cfg.LeaderLease)
+		leaderElector.Register("scheduler", jobScheduler.Run)
+		leaderElector.Register("uploaded_orders", loyaltyProcessor.ListenUploaded)
+		leaderElector.Register("webhook_dispatcher", func(ctx context.Context) {
+			webhookDispatcher.Run(ctx, webhookDispatchPeriod)
+		})
+		if outboxRelay != nil {
+			leaderElector.Register("outbox_relay", func(ctx context.Context) {
+				outboxRelay.Run(ctx, outboxRelayPeriod)
+			})
+		}
+		healthService.RegisterInformational("leader", leaderElector.CheckLeader)
+	}
+
+	prometheus.MustRegister(metrics.NewDBStatsCollector(db))
+
+	rateLimits, err := ratelimit.ParseLimits(cfg.RateLimits)
+	if err != nil {
+		logger.Sugar.Fatalf("error parsing rate limits: %v", err)
+	}
+	trustedProxies, err := ratelimit.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		logger.Sugar.Fatalf("error parsing trusted proxies: %v", err)
+	}
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
+	var validator func(http.Handler) http.Handler
+	if cfg.OpenAPIValidation {
+		validator, err = api.OpenAPIValidator()
+		if err != nil {
+			logger.Sugar.Fatalf("error loading OpenAPI document: %v", err)
+		}
+	}
+
+	rateLimitStore := ratelimit.NewMemoryStore()
+	router := api.Router(api.Dependencies{
+		Orders:      orderStorage,
+		Users:       userStorage,
+		Balances:    balanceStorage,
+		Events:      eventBroker,
+		Webhooks:    webhookStorage,
+		Idempotency: idempotencyStorage,
+		Health:      healthService,
+		Admin:       db,
+		Jobs:        jobScheduler,
+		AdminToken:  cfg.AdminToken,
+		RateLimits:  api.RateLimits{Store: rateLimitStore, Routes: rateLimits, TrustedProxies: trustedProxies},
+		Validator:   validator,
+	})
+	server := &http.Server{
+		Addr:    cfg.RunAddress,
+		Handler: router,
+	}
+	server.RegisterOnShutdown(eventBroker.CloseSubscriptions)
+
+	// metrics are served on their own listener, which is kept off the
+	// public network
+	var metricsServer *http.Server
+	if cfg.MetricsAddress != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", promhttp.Handler())
+		metricsServer = &http.Server{
+			Addr:    cfg.MetricsAddress,
+			Handler: metricsMux,
+		}
+		go func() {
+			err := metricsServer.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Sugar.Fatalf("error starting metrics server: %v", err)
+			}
+		}()
+	}
+
 	go func() {
 		logger.Sugar.Infoln("starting server")
-		err := http.ListenAndServe(cfg.RunAddress, api.Router(orderStorage, userStorage, balanceStorage))
-		if err != nil {
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.Sugar.Fatalf("error starting server: %v", err)
 		}
 	}()
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	loyaltyProcessor.Start(ctx, 10*time.Second)
+	ctx := context.Background()
+	eventBroker.Start(ctx)
+	if leaderElector != nil {
+		leaderElector.Start(ctx)
+	} else {
+		jobScheduler.Start(ctx)
+		loyaltyProcessor.Start(ctx)
+		webhookDispatcher.Start(ctx, webhookDispatchPeriod)
+		if outboxRelay != nil {
+			outboxRelay.Start(ctx, outboxRelayPeriod)
+		}
+	}
 
 	<-quit
+	logger.Sugar.Infoln("shutting down")
+
+	// report not ready and give load balancers time to notice before the
+	// listener is closed
+	healthService.SetShuttingDown()
+	time.Sleep(cfg.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// stop taking requests first, so that in-flight withdrawals complete
+	// before the storage goes away
+	steps := []shutdownStep{{name: "server", stop: server.Shutdown}}
+	if metricsServer != nil {
+		steps = append(steps, shutdownStep{name: "metrics server", stop: metricsServer.Shutdown})
+	}
+	if leaderElector != nil {
+		steps = append(steps, shutdownStep{name: "leaderElector", stop: leaderElector.Stop})
+	}
+	steps = append(steps,
+		shutdownStep{name: "jobScheduler", stop: jobScheduler.Stop},
+		shutdownStep{name: "loyaltyProcessorService", stop: loyaltyProcessor.Stop},
+		shutdownStep{name: "webhookDispatcher", stop: webhookDispatcher.Stop},
+	)
+	if outboxRelay != nil {
+		steps = append(steps, shutdownStep{name: "outboxRelay", stop: outboxRelay.Stop})
+	}
+	steps = append(steps, shutdownStep{name: "eventBroker", stop: eventBroker.Stop})
+	if eventPublisher != nil {
+		steps = append(steps, shutdownStep{name: "event bus publisher", stop: func(context.Context) error { return eventPublisher.Close() }})
+	}
+	steps = append(steps,
+		shutdownStep{name: "database", stop: func(context.Context) error { return db.Close() }},
+		shutdownStep{name: "tracing", stop: shutdownTracing},
+	)
+	shutdown(shutdownCtx, steps)
+	logger.Sugar.Infoln("server stopped")
+}
+
+// shutdownStep stops one part of the server.
+type shutdownStep struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+// shutdown runs steps in order, sharing the deadline of ctx. A step that
+// fails or runs out of time is logged and the next one is run anyway, so that
+// the database is closed even when a service hangs.
+func shutdown(ctx context.Context, steps []shutdownStep) error {
+	var errs []error
+	for _, step := range steps {
+		if err := step.stop(ctx); err != nil {
+			logger.Sugar.Errorf("error stopping %s: %v", step.name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", step.name, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func Execute() error {
@@ -74,8 +442,37 @@ func Execute() error {
 }
 
 func init() {
-	cfg = NewConfig()
-	rootCmd.Flags().StringVarP(&cfg.RunAddress, "address", "a", defaultRunAddress, "run address for the server in the format host:port")
-	rootCmd.Flags().StringVarP(&cfg.DatabaseURI, "database-uri", "d", "", "database connection string")
-	rootCmd.Flags().StringVarP(&cfg.AccrualSystemAddress, "accrual-system-address", "r", "", "accrual system address")
+	registerServerFlags(rootCmd.Flags(), cfg)
+}
+
+// registerServerFlags binds the server flags to c and sets c to their
+// defaults.
+func registerServerFlags(flags *pflag.FlagSet, c *Config) {
+	flags.StringVarP(&c.ConfigFile, "config", "c", "", "YAML or TOML config file, overridden by the environment and flags")
+	flags.StringVar(&c.LogLevel, "log-level", defaultLogLevel, "log level: DEBUG, INFO, WARNING or ERROR")
+	flags.StringVarP(&c.RunAddress, "address", "a", defaultRunAddress, "run address for the server in the format host:port")
+	flags.StringVar(&c.MetricsAddress, "metrics-address", defaultMetricsAddress, "address of the internal listener serving /metrics, empty to disable")
+	flags.StringVarP(&c.DatabaseURI, "database-uri", "d", "", "database connection string")
+	flags.StringVarP(&c.AccrualSystemAddress, "accrual-system-address", "r", "", "accrual system address")
+	flags.DurationVar(&c.PollInterval, "poll-interval", defaultPollInterval, "interval of the sweep over all unfinished orders")
+	flags.StringVar(&c.OrderNotifications, "order-notifications", "postgres", "how uploaded orders reach the processor: postgres, memory for a single instance, or empty to rely on polling")
+	flags.BoolVar(&c.LeaderElection, "leader-election", true, "run background jobs only on the instance holding the leader lock")
+	flags.DurationVar(&c.LeaderLease, "leader-lease", defaultLeaderLease, "lease of the leader, renewed three times per lease")
+	flags.StringVar(&c.InstanceID, "instance-id", "", "name of this instance in the leader election, defaults to host name and process ID")
+	flags.DurationVar(&c.AccrualTimeout, "accrual-timeout", defaultAccrualTimeout, "timeout of requests to the accrual system")
+	flags.StringVar(&c.AccrualCAFile, "accrual-ca-file", "", "PEM file with additional CAs trusted for the accrual system")
+	flags.BoolVar(&c.AccrualInsecure, "accrual-insecure", false, "skip TLS certificate verification of the accrual system")
+	flags.StringVar(&c.AccrualAuthHeader, "accrual-auth-header", "", "Authorization header value sent to the accrual system")
+	flags.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", defaultShutdownTimeout, "time to wait for in-flight requests and background work on shutdown")
+	flags.DurationVar(&c.ShutdownDelay, "shutdown-delay", 0, "time to keep serving while reporting not ready before shutting down")
+	flags.StringVar(&c.EventBus, "event-bus", "", "event bus publisher for outbox events: nats, file or memory, empty to disable")
+	flags.StringVar(&c.EventBusFile, "event-bus-file", defaultEventBusFile, "file the file event bus publisher appends to")
+	flags.StringVar(&c.NATSURL, "nats-url", defaultNATSURL, "NATS server URL for the nats event bus publisher")
+	flags.StringVar(&c.TracingExporter, "tracing-exporter", "", "trace exporter: otlp, stdout or file, empty to disable tracing")
+	flags.StringVar(&c.TracingEndpoint, "tracing-endpoint", "", "OTLP/HTTP collector URL for the otlp trace exporter, defaults to OTEL_EXPORTER_OTLP_ENDPOINT")
+	flags.StringVar(&c.TracingFile, "tracing-file", defaultTracingFile, "file the file trace exporter appends spans to")
+	flags.BoolVar(&c.OpenAPIValidation, "openapi-validation", false, "validate requests and responses against the OpenAPI document")
+	flags.StringVar(&c.AdminToken, "admin-token", "", "token expected in the X-Admin-Token header of admin requests, empty to disable the admin API")
+	flags.StringVar(&c.RateLimits, "rate-limits", defaultRateLimits, "comma separated route=requests/window rate limits, empty to disable")
+	flags.StringVar(&c.TrustedProxies, "trusted-proxies", "", "comma separated addresses or CIDR prefixes of proxies whose X-Forwarded-For is trusted for rate limiting")
 }
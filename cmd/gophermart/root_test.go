@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdown(t *testing.T) {
+	var stopped []string
+	step := func(name string, err error) shutdownStep {
+		return shutdownStep{name: name, stop: func(context.Context) error {
+			stopped = append(stopped, name)
+			return err
+		}}
+	}
+	hanging := shutdownStep{name: "loyaltyProcessorService", stop: func(ctx context.Context) error {
+		stopped = append(stopped, "loyaltyProcessorService")
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := shutdown(ctx, []shutdownStep{
+		step("server", nil),
+		hanging,
+		step("event bus publisher", errors.New("nats: connection closed")),
+		step("database", nil),
+	})
+
+	// the server stops before the services and the database after them, even
+	// when a service runs out of time
+	assert.Equal(t, []string{"server", "loyaltyProcessorService", "event bus publisher", "database"}, stopped)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "loyaltyProcessorService")
+	assert.Contains(t, err.Error(), "event bus publisher: nats: connection closed")
+	assert.NotContains(t, err.Error(), "database")
+}
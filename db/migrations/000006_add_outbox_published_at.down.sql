@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_outbox_unpublished;
+ALTER TABLE outbox DROP COLUMN IF EXISTS published_at;
\ No newline at end of file
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_orders_dead_lettered;
+DROP INDEX IF EXISTS idx_orders_due;
+ALTER TABLE orders DROP COLUMN IF EXISTS dead_lettered_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS last_error;
+ALTER TABLE orders DROP COLUMN IF EXISTS next_check_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS attempts;
@@ -0,0 +1,9 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS next_check_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS last_error TEXT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS dead_lettered_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_orders_due ON orders (next_check_at)
+    WHERE status IN ('NEW', 'PROCESSING') AND dead_lettered_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_orders_dead_lettered ON orders (dead_lettered_at)
+    WHERE dead_lettered_at IS NOT NULL;
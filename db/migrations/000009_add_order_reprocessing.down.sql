@@ -0,0 +1,18 @@
+-- corrections cannot be kept once order numbers are unique again, and
+-- deleting them would silently change balances
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM transactions WHERE type = 'correction') THEN
+        RAISE EXCEPTION 'transactions hold accrual corrections, fold them into the accruals before migrating down';
+    END IF;
+END $$;
+
+DROP INDEX IF EXISTS idx_transactions_order_number;
+ALTER TABLE transactions ADD CONSTRAINT transactions_order_number_key UNIQUE (order_number);
+
+DROP INDEX IF EXISTS idx_orders_due;
+CREATE INDEX IF NOT EXISTS idx_orders_due ON orders (next_check_at)
+    WHERE status IN ('NEW', 'PROCESSING') AND dead_lettered_at IS NULL;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS recheck_correct;
+ALTER TABLE orders DROP COLUMN IF EXISTS recheck;
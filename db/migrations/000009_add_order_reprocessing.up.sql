@@ -0,0 +1,11 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS recheck BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS recheck_correct BOOLEAN NOT NULL DEFAULT FALSE;
+
+DROP INDEX IF EXISTS idx_orders_due;
+CREATE INDEX IF NOT EXISTS idx_orders_due ON orders (next_check_at)
+    WHERE (status IN ('NEW', 'PROCESSING') OR recheck) AND dead_lettered_at IS NULL;
+
+-- corrections are posted for orders that already have an accrual
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_order_number_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_order_number ON transactions (order_number)
+    WHERE type <> 'correction';
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS job_runs (
+    id BIGSERIAL PRIMARY KEY,
+    job VARCHAR(64) NOT NULL,
+    trigger VARCHAR(16) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    instance VARCHAR(255),
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_job ON job_runs (job, id DESC);
+CREATE INDEX IF NOT EXISTS idx_job_runs_pending ON job_runs (job, id) WHERE status = 'pending';
@@ -0,0 +1,3 @@
+UPDATE idempotency_keys SET response_headers = response_headers - 'Authorization' WHERE response_headers ? 'Authorization';
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys (created_at);
@@ -0,0 +1 @@
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS publish_claimed_until TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,3 @@
+UPDATE transactions t SET order_number = o.id::text
+FROM orders o
+WHERE t.type = 'accrual' AND t.order_number = o.order_number;
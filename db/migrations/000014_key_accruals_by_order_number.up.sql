@@ -0,0 +1,4 @@
+-- accruals used to be keyed by orders.id, unlike withdrawals and corrections
+UPDATE transactions t SET order_number = o.order_number
+FROM orders o
+WHERE t.type = 'accrual' AND t.order_number = o.id::text;
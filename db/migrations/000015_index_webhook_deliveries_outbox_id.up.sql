@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_outbox_id ON webhook_deliveries (outbox_id);
@@ -0,0 +1,184 @@
+// Package accrual is the HTTP client of the accrual system.
+package accrual
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/evgfitil/gophermart.git/internal/metrics"
+)
+
+const (
+	defaultTimeout    = 10 * time.Second
+	defaultRetryAfter = time.Second
+)
+
+// Order statuses of the accrual system.
+const (
+	StatusRegistered = "REGISTERED"
+	StatusProcessing = "PROCESSING"
+	StatusInvalid    = "INVALID"
+	StatusProcessed  = "PROCESSED"
+)
+
+var (
+	ErrNotRegistered     = errors.New("order is not registered in the accrual system")
+	ErrServer            = errors.New("accrual system error")
+	ErrMalformedResponse = errors.New("malformed accrual system response")
+)
+
+// RateLimitError is returned when the accrual system rejects a request
+// because of its rate limit.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("accrual system rate limit exceeded, retry after %v", e.RetryAfter)
+}
+
+// Order is the accrual system's view of an order.
+type Order struct {
+	Number  string  `json:"order"`
+	Status  string  `json:"status"`
+	Accrual float64 `json:"accrual,omitempty"`
+}
+
+type Config struct {
+	// Timeout bounds every request, 10s by default
+	Timeout time.Duration
+	// CAFile is a PEM file with the CAs trusted in addition to the system
+	// ones
+	CAFile             string
+	InsecureSkipVerify bool
+	// Headers are sent with every request, e.g. Authorization
+	Headers map[string]string
+}
+
+type HTTPClient struct {
+	baseURL *url.URL
+	client  *resty.Client
+}
+
+func NewHTTPClient(baseURL string, cfg Config) (*HTTPClient, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid accrual system address: %w", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CAFile != "" || cfg.InsecureSkipVerify {
+		transport.TLSClientConfig, err = tlsConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	// the transport propagates the W3C trace context to the accrual system
+	client := resty.New().
+		SetTransport(otelhttp.NewTransport(transport,
+			otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+				return "accrual " + req.Method
+			}),
+		)).
+		SetTimeout(timeout).
+		SetHeaders(cfg.Headers)
+
+	return &HTTPClient{baseURL: u, client: client}, nil
+}
+
+func tlsConfig(cfg Config) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile == "" {
+		return config, nil
+	}
+
+	pem, err := os.ReadFile(cfg.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading accrual CA file: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+	}
+	config.RootCAs = pool
+	return config, nil
+}
+
+// GetOrder returns the accrual status of the order. Besides transport errors
+// it fails with ErrNotRegistered, *RateLimitError, ErrServer or
+// ErrMalformedResponse.
+func (c *HTTPClient) GetOrder(ctx context.Context, number string) (*Order, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Get(c.baseURL.JoinPath("api", "orders", number).String())
+	if err != nil {
+		metrics.AccrualRequestsTotal.WithLabelValues("error").Inc()
+		return nil, fmt.Errorf("error making request to accrual system: %w", err)
+	}
+	metrics.AccrualRequestsTotal.WithLabelValues(strconv.Itoa(resp.StatusCode())).Inc()
+
+	switch code := resp.StatusCode(); {
+	case code == http.StatusOK:
+	case code == http.StatusNoContent:
+		return nil, ErrNotRegistered
+	case code == http.StatusTooManyRequests:
+		return nil, &RateLimitError{RetryAfter: retryAfter(resp.Header().Get("Retry-After"), time.Now())}
+	case code >= http.StatusInternalServerError:
+		return nil, fmt.Errorf("%w: status %d", ErrServer, code)
+	default:
+		return nil, fmt.Errorf("%w: unexpected status %d", ErrMalformedResponse, code)
+	}
+
+	var order Order
+	if err = json.Unmarshal(resp.Body(), &order); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedResponse, err)
+	}
+	return &order, nil
+}
+
+// Ping requests the base URL and returns the status code, whatever it is.
+func (c *HTTPClient) Ping(ctx context.Context) (int, error) {
+	resp, err := c.client.R().SetContext(ctx).Get(c.baseURL.String())
+	if err != nil {
+		return 0, err
+	}
+	return resp.StatusCode(), nil
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP
+// date, falling back to one second.
+func retryAfter(value string, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
@@ -0,0 +1,116 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/evgfitil/gophermart.git/internal/accrualmock"
+)
+
+func TestHTTPClientGetOrder(t *testing.T) {
+	mock := accrualmock.New(accrualmock.Config{
+		Rules:      []accrualmock.Rule{{Prefix: "1", Accrual: 500}},
+		RetryAfter: 60 * time.Second,
+	})
+	ts := mock.Start()
+	defer ts.Close()
+
+	client, err := NewHTTPClient(ts.URL, Config{})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	order, err := client.GetOrder(ctx, "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, &Order{Number: "12345678903", Status: "PROCESSED", Accrual: 500}, order)
+
+	_, err = client.GetOrder(ctx, "2377225624")
+	assert.ErrorIs(t, err, ErrNotRegistered)
+
+	mock.FailNext(http.StatusTooManyRequests, 1)
+	_, err = client.GetOrder(ctx, "12345678903")
+	var rateLimitErr *RateLimitError
+	require.True(t, errors.As(err, &rateLimitErr))
+	assert.Equal(t, 60*time.Second, rateLimitErr.RetryAfter)
+
+	mock.FailNext(http.StatusInternalServerError, 1)
+	_, err = client.GetOrder(ctx, "12345678903")
+	assert.ErrorIs(t, err, ErrServer)
+}
+
+func TestHTTPClientMalformedResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte(`{"order": `))
+	}))
+	defer ts.Close()
+
+	client, err := NewHTTPClient(ts.URL, Config{})
+	require.NoError(t, err)
+
+	_, err = client.GetOrder(context.Background(), "12345678903")
+	assert.ErrorIs(t, err, ErrMalformedResponse)
+}
+
+func TestHTTPClientOptions(t *testing.T) {
+	var gotAuth string
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		gotAuth = req.Header.Get("Authorization")
+		if req.URL.Path == "/api/orders/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		res.Write([]byte(`{"order": "12345678903", "status": "PROCESSING"}`))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+
+	_, err := NewHTTPClient(ts.URL, Config{CAFile: "testdata/missing.pem"})
+	assert.Error(t, err)
+
+	untrusted, err := NewHTTPClient(ts.URL, Config{})
+	require.NoError(t, err)
+	_, err = untrusted.GetOrder(ctx, "12345678903")
+	assert.Error(t, err, "certificate of the test server must not be trusted")
+
+	client, err := NewHTTPClient(ts.URL, Config{
+		Timeout:            50 * time.Millisecond,
+		InsecureSkipVerify: true,
+		Headers:            map[string]string{"Authorization": "Bearer secret"},
+	})
+	require.NoError(t, err)
+
+	order, err := client.GetOrder(ctx, "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, "PROCESSING", order.Status)
+	assert.Equal(t, "Bearer secret", gotAuth)
+
+	_, err = client.GetOrder(ctx, "slow")
+	assert.Error(t, err)
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "seconds", value: "120", want: 2 * time.Minute},
+		{name: "http date", value: "Wed, 01 May 2024 12:00:30 GMT", want: 30 * time.Second},
+		{name: "past http date", value: "Wed, 01 May 2024 11:00:00 GMT", want: 0},
+		{name: "missing", value: "", want: time.Second},
+		{name: "invalid", value: "soon", want: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, retryAfter(tt.value, now))
+		})
+	}
+}
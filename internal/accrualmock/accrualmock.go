@@ -0,0 +1,216 @@
+// Package accrualmock is a stand-in for the accrual system. It serves
+// GET /api/orders/{number} like the real service, moving every known order
+// through REGISTERED and PROCESSING to PROCESSED or INVALID, and can inject
+// latency and failures.
+package accrualmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	StatusRegistered = "REGISTERED"
+	StatusProcessing = "PROCESSING"
+	StatusInvalid    = "INVALID"
+	StatusProcessed  = "PROCESSED"
+)
+
+// Rule decides the outcome for order numbers starting with Prefix. An empty
+// prefix matches every order.
+type Rule struct {
+	Prefix  string
+	Accrual float64
+	Invalid bool
+}
+
+type Config struct {
+	// Rules are tried in order, orders matching no rule are not registered
+	// and answered with 204
+	Rules []Rule
+	// PendingPolls is how many requests for an order are answered with
+	// REGISTERED and then PROCESSING before the final status
+	PendingPolls int
+	Latency      time.Duration
+	// RateLimitRate and ErrorRate are the fractions of requests answered
+	// with 429 and 500
+	RateLimitRate float64
+	RetryAfter    time.Duration
+	ErrorRate     float64
+}
+
+type orderResponse struct {
+	Order   string  `json:"order"`
+	Status  string  `json:"status"`
+	Accrual float64 `json:"accrual,omitempty"`
+}
+
+type Server struct {
+	cfg     Config
+	handler http.Handler
+
+	mu       sync.Mutex
+	polls    map[string]int
+	failures []int
+	rand     *rand.Rand
+}
+
+func New(cfg Config) *Server {
+	s := &Server{
+		cfg:   cfg,
+		polls: make(map[string]int),
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	r := chi.NewRouter()
+	r.Get("/api/orders/{number}", s.handleOrder)
+	s.handler = r
+	return s
+}
+
+// Start serves s on a local httptest server, to be closed by the caller.
+func (s *Server) Start() *httptest.Server {
+	return httptest.NewServer(s)
+}
+
+func (s *Server) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	s.handler.ServeHTTP(res, req)
+}
+
+// FailNext answers the next n requests with status, ahead of the
+// configured rates.
+func (s *Server) FailNext(status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, status)
+	}
+}
+
+// Polls returns how many times the order was successfully requested.
+func (s *Server) Polls(number string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.polls[number]
+}
+
+func (s *Server) handleOrder(res http.ResponseWriter, req *http.Request) {
+	if s.cfg.Latency > 0 {
+		select {
+		case <-time.After(s.cfg.Latency):
+		case <-req.Context().Done():
+			return
+		}
+	}
+
+	number := chi.URLParam(req, "number")
+	s.mu.Lock()
+	status := s.failure()
+	var polls int
+	if status == 0 {
+		s.polls[number]++
+		polls = s.polls[number]
+	}
+	s.mu.Unlock()
+
+	switch status {
+	case 0:
+	case http.StatusTooManyRequests:
+		retryAfter := int(math.Ceil(s.cfg.RetryAfter.Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		res.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		http.Error(res, "No more than N requests per minute allowed", status)
+		return
+	default:
+		http.Error(res, http.StatusText(status), status)
+		return
+	}
+
+	rule, ok := s.match(number)
+	if !ok {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	response := orderResponse{Order: number}
+	switch {
+	case polls == 1 && s.cfg.PendingPolls > 0:
+		response.Status = StatusRegistered
+	case polls <= s.cfg.PendingPolls:
+		response.Status = StatusProcessing
+	case rule.Invalid:
+		response.Status = StatusInvalid
+	default:
+		response.Status = StatusProcessed
+		response.Accrual = rule.Accrual
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(response)
+}
+
+// failure returns the status to fail the current request with, or 0.
+// s.mu must be held.
+func (s *Server) failure() int {
+	if len(s.failures) > 0 {
+		status := s.failures[0]
+		s.failures = s.failures[1:]
+		return status
+	}
+	if s.cfg.RateLimitRate > 0 && s.rand.Float64() < s.cfg.RateLimitRate {
+		return http.StatusTooManyRequests
+	}
+	if s.cfg.ErrorRate > 0 && s.rand.Float64() < s.cfg.ErrorRate {
+		return http.StatusInternalServerError
+	}
+	return 0
+}
+
+func (s *Server) match(number string) (Rule, bool) {
+	for _, rule := range s.cfg.Rules {
+		if strings.HasPrefix(number, rule.Prefix) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// ParseRules parses comma separated prefix=accrual rules, where accrual is
+// a number of points or "invalid" and the prefix "*" matches every order,
+// e.g. "1=500,2=invalid,*=100".
+func ParseRules(s string) ([]Rule, error) {
+	var rules []Rule
+	if strings.TrimSpace(s) == "" {
+		return rules, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		prefix, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || prefix == "" {
+			return nil, fmt.Errorf("invalid rule %q, expected prefix=accrual", pair)
+		}
+		if prefix == "*" {
+			prefix = ""
+		}
+		if value == "invalid" {
+			rules = append(rules, Rule{Prefix: prefix, Invalid: true})
+			continue
+		}
+		accrual, err := strconv.ParseFloat(value, 64)
+		if err != nil || accrual < 0 {
+			return nil, fmt.Errorf("invalid accrual in rule %q", pair)
+		}
+		rules = append(rules, Rule{Prefix: prefix, Accrual: accrual})
+	}
+	return rules, nil
+}
@@ -0,0 +1,143 @@
+package accrualmock
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getOrder(t *testing.T, url, number string) (*http.Response, orderResponse) {
+	t.Helper()
+	resp, err := http.Get(url + "/api/orders/" + number)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var order orderResponse
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+	}
+	return resp, order
+}
+
+func TestServerLifecycle(t *testing.T) {
+	mock := New(Config{
+		Rules:        []Rule{{Prefix: "2", Invalid: true}, {Accrual: 500}},
+		PendingPolls: 2,
+	})
+	ts := mock.Start()
+	defer ts.Close()
+
+	tests := []struct {
+		name        string
+		number      string
+		wantStatus  []string
+		wantAccrual float64
+	}{
+		{
+			name:        "processed",
+			number:      "12345678903",
+			wantStatus:  []string{StatusRegistered, StatusProcessing, StatusProcessed, StatusProcessed},
+			wantAccrual: 500,
+		},
+		{
+			name:       "invalid",
+			number:     "2377225624",
+			wantStatus: []string{StatusRegistered, StatusProcessing, StatusInvalid},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var order orderResponse
+			for _, want := range tt.wantStatus {
+				var resp *http.Response
+				resp, order = getOrder(t, ts.URL, tt.number)
+				require.Equal(t, http.StatusOK, resp.StatusCode)
+				assert.Equal(t, tt.number, order.Order)
+				assert.Equal(t, want, order.Status)
+			}
+			assert.Equal(t, tt.wantAccrual, order.Accrual)
+			assert.Equal(t, len(tt.wantStatus), mock.Polls(tt.number))
+		})
+	}
+}
+
+func TestServerUnregisteredOrder(t *testing.T) {
+	ts := New(Config{Rules: []Rule{{Prefix: "1", Accrual: 100}}}).Start()
+	defer ts.Close()
+
+	resp, _ := getOrder(t, ts.URL, "2377225624")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestServerFailures(t *testing.T) {
+	mock := New(Config{Rules: []Rule{{Accrual: 100}}, RetryAfter: 3 * time.Second})
+	ts := mock.Start()
+	defer ts.Close()
+
+	mock.FailNext(http.StatusTooManyRequests, 1)
+	mock.FailNext(http.StatusInternalServerError, 1)
+
+	resp, _ := getOrder(t, ts.URL, "12345678903")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "3", resp.Header.Get("Retry-After"))
+
+	resp, _ = getOrder(t, ts.URL, "12345678903")
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	resp, order := getOrder(t, ts.URL, "12345678903")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, StatusProcessed, order.Status)
+	assert.Equal(t, 1, mock.Polls("12345678903"))
+
+	rateLimited := New(Config{Rules: []Rule{{Accrual: 100}}, RateLimitRate: 1})
+	ts2 := rateLimited.Start()
+	defer ts2.Close()
+	resp, _ = getOrder(t, ts2.URL, "12345678903")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+}
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Rule
+		wantErr bool
+	}{
+		{
+			name:  "rules",
+			input: "1=500, 2=invalid,*=12.5",
+			want:  []Rule{{Prefix: "1", Accrual: 500}, {Prefix: "2", Invalid: true}, {Accrual: 12.5}},
+		},
+		{
+			name:  "empty",
+			input: "",
+		},
+		{
+			name:    "missing accrual",
+			input:   "1",
+			wantErr: true,
+		},
+		{
+			name:    "negative accrual",
+			input:   "1=-5",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseRules(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, rules)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/jwtauth"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/evgfitil/gophermart.git/internal/logger"
+)
+
+const (
+	requestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 128
+	requestIDSize      = 16
+)
+
+// RequestID propagates the caller's X-Request-ID or assigns a new one, echoes
+// it in the response and puts a logger carrying it into the request context.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		requestID := req.Header.Get(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		res.Header().Set(requestIDHeader, requestID)
+
+		log := logger.FromContext(req.Context()).With("request_id", requestID)
+		if spanContext := trace.SpanContextFromContext(req.Context()); spanContext.IsValid() {
+			log = log.With("trace_id", spanContext.TraceID().String())
+		}
+		next.ServeHTTP(res, req.WithContext(logger.WithContext(req.Context(), log)))
+	})
+}
+
+// validRequestID accepts ids of printable ASCII characters only, so that a
+// caller cannot inject anything into logs or response headers.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID falls back to a timestamp in the unlikely case the system
+// random source fails, a request id does not need to be unpredictable.
+func newRequestID() string {
+	b := make([]byte, requestIDSize)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// AccessLog writes one line per request with the request-scoped logger. It
+// has to run after jwtauth.Verifier to know the user.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(res, req.ProtoMajor)
+		next.ServeHTTP(ww, req)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		fields := []any{
+			"method", req.Method,
+			"path", req.URL.Path,
+			"route", routePattern(req),
+			"status", status,
+			"latency", time.Since(start),
+			"bytes", ww.BytesWritten(),
+		}
+		if token, claims, err := jwtauth.FromContext(req.Context()); err == nil && token != nil {
+			if userID, ok := claims["user_id"].(string); ok {
+				fields = append(fields, "user_id", userID)
+			}
+		}
+		logger.FromContext(req.Context()).Infow("request", fields...)
+	})
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/evgfitil/gophermart.git/internal/logger"
+)
+
+func TestRequestID(t *testing.T) {
+	var handlerLogger *zap.SugaredLogger
+	ts := httptest.NewServer(RequestID(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		handlerLogger = logger.FromContext(req.Context())
+	})))
+	defer ts.Close()
+
+	tests := []struct {
+		name      string
+		requestID string
+		wantSame  bool
+	}{
+		{
+			name:      "propagates caller id",
+			requestID: "3f2c9a7e-client-id",
+			wantSame:  true,
+		},
+		{
+			name:      "assigns id when missing",
+			requestID: "",
+			wantSame:  false,
+		},
+		{
+			name:      "replaces id with spaces",
+			requestID: "bad id",
+			wantSame:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlerLogger = nil
+			req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+			require.NoError(t, err)
+			if tt.requestID != "" {
+				req.Header.Set(requestIDHeader, tt.requestID)
+			}
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			got := resp.Header.Get(requestIDHeader)
+			require.NotEmpty(t, got)
+			if tt.wantSame {
+				assert.Equal(t, tt.requestID, got)
+			} else {
+				assert.NotEqual(t, tt.requestID, got)
+			}
+			assert.NotSame(t, logger.Sugar, handlerLogger)
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	defaultLogger := logger.Sugar
+	logger.Sugar = zap.New(core).Sugar()
+	defer func() { logger.Sugar = defaultLogger }()
+
+	r := chi.NewRouter()
+	r.Use(RequestID)
+	r.Use(jwtauth.Verifier(tokenAuth))
+	r.Use(AccessLog)
+	r.Get("/api/user/orders", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("[]"))
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	token, err := generateToken("test_user")
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/user/orders", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(requestIDHeader, "req-1")
+
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	entries := logs.FilterMessage("request").All()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "req-1", fields["request_id"])
+	assert.Equal(t, "/api/user/orders", fields["route"])
+	assert.Equal(t, int64(http.StatusOK), fields["status"])
+	assert.Equal(t, int64(2), fields["bytes"])
+	assert.Equal(t, "test_user", fields["user_id"])
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+const (
+	adminTokenHeader       = "X-Admin-Token"
+	defaultDeadLetterLimit = 100
+	maxDeadLetterLimit     = 1000
+)
+
+type AdminStorage interface {
+	GetDeadLetterOrders(ctx context.Context, limit int) ([]models.DeadLetterOrder, error)
+	RequeueOrder(ctx context.Context, orderNumber string) error
+}
+
+// RequireAdmin lets through requests carrying the admin token. With an empty
+// token the admin API is disabled and its routes are reported as not found.
+func RequireAdmin(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if token == "" {
+				writeProblem(res, req, apperrors.ErrNotFound)
+				return
+			}
+			got := req.Header.Get(adminTokenHeader)
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				writeProblem(res, req, fmt.Errorf("%w: invalid admin token", apperrors.ErrUnauthorized))
+				return
+			}
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// queryLimit parses the limit query parameter, which defaults to
+// defaultLimit and may not exceed maxLimit.
+func queryLimit(req *http.Request, defaultLimit int, maxLimit int) (int, error) {
+	value := req.URL.Query().Get("limit")
+	if value == "" {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxLimit {
+		return 0, fmt.Errorf("%w: limit must be between 1 and %d", apperrors.ErrInvalidRequest, maxLimit)
+	}
+	return limit, nil
+}
+
+func HandleGetDeadLetterOrders(as AdminStorage) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		requestContext, cancel := context.WithTimeout(req.Context(), requestTimeout)
+		defer cancel()
+
+		limit, err := queryLimit(req, defaultDeadLetterLimit, maxDeadLetterLimit)
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		orders, err := as.GetDeadLetterOrders(requestContext, limit)
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		if len(orders) == 0 {
+			res.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(orders)
+	}
+}
+
+func HandleRequeueOrder(as AdminStorage) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		requestContext, cancel := context.WithTimeout(req.Context(), requestTimeout)
+		defer cancel()
+
+		if err := as.RequeueOrder(requestContext, chi.URLParam(req, "number")); err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+	"github.com/evgfitil/gophermart.git/internal/mocks"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+func TestHandleAdminOrders(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAdminStorage := mocks.NewMockAdminStorage(ctrl)
+
+	r := chi.NewRouter()
+	r.With(RequireAdmin("admin-secret")).Route("/api/admin/orders", func(r chi.Router) {
+		r.Get("/dead-letter", HandleGetDeadLetterOrders(mockAdminStorage))
+		r.Post("/{number}/requeue", HandleRequeueOrder(mockAdminStorage))
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	tests := []struct {
+		name          string
+		requestMethod string
+		path          string
+		token         string
+		mockSetup     func()
+		wantStatus    int
+	}{
+		{
+			name:          "list dead letter",
+			requestMethod: http.MethodGet,
+			path:          "/api/admin/orders/dead-letter",
+			token:         "admin-secret",
+			mockSetup: func() {
+				mockAdminStorage.EXPECT().GetDeadLetterOrders(gomock.Any(), defaultDeadLetterLimit).Return([]models.DeadLetterOrder{
+					{OrderNumber: "12345678903", UserID: 1, Status: "NEW", Attempts: 20, DeadLetteredAt: time.Now()},
+				}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "empty dead letter",
+			requestMethod: http.MethodGet,
+			path:          "/api/admin/orders/dead-letter?limit=10",
+			token:         "admin-secret",
+			mockSetup: func() {
+				mockAdminStorage.EXPECT().GetDeadLetterOrders(gomock.Any(), 10).Return(nil, nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:          "invalid limit",
+			requestMethod: http.MethodGet,
+			path:          "/api/admin/orders/dead-letter?limit=0",
+			token:         "admin-secret",
+			mockSetup:     func() {},
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:          "wrong token",
+			requestMethod: http.MethodGet,
+			path:          "/api/admin/orders/dead-letter",
+			token:         "guess",
+			mockSetup:     func() {},
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "requeue",
+			requestMethod: http.MethodPost,
+			path:          "/api/admin/orders/12345678903/requeue",
+			token:         "admin-secret",
+			mockSetup: func() {
+				mockAdminStorage.EXPECT().RequeueOrder(gomock.Any(), "12345678903").Return(nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:          "requeue order not dead-lettered",
+			requestMethod: http.MethodPost,
+			path:          "/api/admin/orders/2377225624/requeue",
+			token:         "admin-secret",
+			mockSetup: func() {
+				mockAdminStorage.EXPECT().RequeueOrder(gomock.Any(), "2377225624").Return(apperrors.ErrOrderNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			req, err := http.NewRequest(tt.requestMethod, ts.URL+tt.path, nil)
+			require.NoError(t, err)
+			req.Header.Set(adminTokenHeader, tt.token)
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestRequireAdminDisabled(t *testing.T) {
+	handler := RequireAdmin("")(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		t.Error("admin handler must not be reached")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/orders/dead-letter", nil)
+	req.Header.Set(adminTokenHeader, "")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
@@ -3,8 +3,8 @@ package api
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"time"
@@ -13,6 +13,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
 	"github.com/evgfitil/gophermart.git/internal/models"
 )
 
@@ -52,40 +53,70 @@ func generateToken(username string) (string, error) {
 	return tokenString, nil
 }
 
+// usernameFromContext returns the login from the verified token claims.
+func usernameFromContext(ctx context.Context) (string, error) {
+	_, claims, err := jwtauth.FromContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", apperrors.ErrUnauthorized, err)
+	}
+	username, ok := claims["user_id"].(string)
+	if !ok {
+		return "", fmt.Errorf("%w: no required claims available", apperrors.ErrUnauthorized)
+	}
+	return username, nil
+}
+
+// Authenticator rejects requests without a valid token. It replaces
+// jwtauth.Authenticator so that rejections are reported as problems too.
+func Authenticator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		token, _, err := jwtauth.FromContext(req.Context())
+		if err != nil {
+			writeProblem(res, req, fmt.Errorf("%w: %v", apperrors.ErrUnauthorized, err))
+			return
+		}
+		if token == nil {
+			writeProblem(res, req, apperrors.ErrUnauthorized)
+			return
+		}
+		next.ServeHTTP(res, req)
+	})
+}
+
 func HandleUserLogin(us UserStorage) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
 		requestContext, cancel := context.WithTimeout(req.Context(), requestTimeout)
 		defer cancel()
 
 		var user models.User
-		if err := json.NewDecoder(req.Body).Decode(&user); err != nil {
-			http.Error(res, "invalid request body", http.StatusBadRequest)
+		if err := decodeJSON(req, &user); err != nil {
+			writeProblem(res, req, err)
 			return
 		}
 
 		if user.Password == "" {
-			http.Error(res, "password is required", http.StatusBadRequest)
+			writeProblem(res, req, fmt.Errorf("%w: password is required", apperrors.ErrInvalidRequest))
 			return
 		}
 
 		storedUserPassword, err := us.GetUserByUsername(requestContext, user.Username)
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
-				http.Error(res, "user not found", http.StatusUnauthorized)
+				writeProblem(res, req, apperrors.ErrInvalidCredentials)
 			} else {
-				http.Error(res, "database error", http.StatusInternalServerError)
+				writeProblem(res, req, err)
 			}
 			return
 		}
 
 		if err = bcrypt.CompareHashAndPassword([]byte(storedUserPassword), []byte(user.Password)); err != nil {
-			http.Error(res, "wrong username or password", http.StatusUnauthorized)
+			writeProblem(res, req, apperrors.ErrInvalidCredentials)
 			return
 		}
 
 		tokenString, err := generateToken(user.Username)
 		if err != nil {
-			http.Error(res, "failed to generate auth token", http.StatusInternalServerError)
+			writeProblem(res, req, fmt.Errorf("failed to generate auth token: %w", err))
 			return
 		}
 
@@ -101,40 +132,40 @@ func HandleUserRegistration(us UserStorage) http.HandlerFunc {
 		defer cancel()
 
 		var user models.User
-		if err := json.NewDecoder(req.Body).Decode(&user); err != nil {
-			http.Error(res, "invalid request body", http.StatusBadRequest)
+		if err := decodeJSON(req, &user); err != nil {
+			writeProblem(res, req, err)
 			return
 		}
 		if user.Password == "" {
-			http.Error(res, "password is required", http.StatusBadRequest)
+			writeProblem(res, req, fmt.Errorf("%w: password is required", apperrors.ErrInvalidRequest))
 			return
 		}
 
 		isUnique, err := us.IsUserUnique(requestContext, user.Username)
 		if err != nil {
-			http.Error(res, "database error", http.StatusInternalServerError)
+			writeProblem(res, req, err)
 			return
 		}
 		if !isUnique {
-			http.Error(res, "user already exists", http.StatusConflict)
+			writeProblem(res, req, apperrors.ErrUserAlreadyExists)
 			return
 		}
 
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 		if err != nil {
-			http.Error(res, "error hashing password", http.StatusInternalServerError)
+			writeProblem(res, req, fmt.Errorf("error hashing password: %w", err))
 			return
 		}
 
 		err = us.CreateUser(requestContext, user.Username, string(hashedPassword))
 		if err != nil {
-			http.Error(res, "error creating user", http.StatusInternalServerError)
+			writeProblem(res, req, fmt.Errorf("error creating user: %w", err))
 			return
 		}
 
 		tokenString, err := generateToken(user.Username)
 		if err != nil {
-			http.Error(res, "failed to generate auth token", http.StatusInternalServerError)
+			writeProblem(res, req, fmt.Errorf("failed to generate auth token: %w", err))
 			return
 		}
 
@@ -3,12 +3,12 @@ package api
 import (
 	"context"
 	"encoding/json"
-	"github.com/ShiraazMoollatjie/goluhn"
-	"github.com/go-chi/jwtauth"
+	"fmt"
 	"net/http"
 
+	"github.com/ShiraazMoollatjie/goluhn"
+
 	"github.com/evgfitil/gophermart.git/internal/apperrors"
-	"github.com/evgfitil/gophermart.git/internal/logger"
 	"github.com/evgfitil/gophermart.git/internal/models"
 )
 
@@ -29,31 +29,21 @@ func HandleGetUserBalance(bs BalanceStorage) http.HandlerFunc {
 		requestContext, cancel := context.WithTimeout(req.Context(), requestTimeout)
 		defer cancel()
 
-		_, claims, err := jwtauth.FromContext(requestContext)
+		username, err := usernameFromContext(requestContext)
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		if claims == nil {
-			http.Error(res, "no claims available", http.StatusUnauthorized)
-			return
-		}
-
-		username, ok := claims["user_id"].(string)
-		if !ok {
-			http.Error(res, "no required claims available", http.StatusUnauthorized)
+			writeProblem(res, req, err)
 			return
 		}
 
 		userID, err := bs.GetUserID(requestContext, username)
 		if err != nil {
-			http.Error(res, "internal server error", http.StatusInternalServerError)
+			writeProblem(res, req, err)
 			return
 		}
 		userBalance, err := bs.GetUserBalance(requestContext, userID)
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusInternalServerError)
+			writeProblem(res, req, err)
+			return
 		}
 		res.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(res).Encode(userBalance)
@@ -65,34 +55,22 @@ func HandleGetWithdrawals(bs BalanceStorage) http.HandlerFunc {
 		requestContext, cancel := context.WithTimeout(req.Context(), requestTimeout)
 		defer cancel()
 
-		_, claims, err := jwtauth.FromContext(requestContext)
+		username, err := usernameFromContext(requestContext)
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		if claims == nil {
-			http.Error(res, "no claims available", http.StatusUnauthorized)
-			return
-		}
-
-		username, ok := claims["user_id"].(string)
-		if !ok {
-			http.Error(res, "no required claims available", http.StatusUnauthorized)
+			writeProblem(res, req, err)
 			return
 		}
 
 		userID, err := bs.GetUserID(requestContext, username)
 		if err != nil {
-			http.Error(res, "internal server error", http.StatusInternalServerError)
+			writeProblem(res, req, err)
 			return
 		}
 
 		var withdrawals []models.Withdrawal
 		withdrawals, err = bs.GetWithdrawals(requestContext, userID)
 		if err != nil {
-			logger.Sugar.Errorf("error retrieving withdrawals: %v", err)
-			http.Error(res, "internal server error", http.StatusInternalServerError)
+			writeProblem(res, req, fmt.Errorf("error retrieving withdrawals: %w", err))
 			return
 		}
 
@@ -111,37 +89,26 @@ func HandleWithdrawBalance(bs BalanceStorage) http.HandlerFunc {
 		requestContext, cancel := context.WithTimeout(req.Context(), requestTimeout)
 		defer cancel()
 
-		_, claims, err := jwtauth.FromContext(requestContext)
+		username, err := usernameFromContext(requestContext)
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		if claims == nil {
-			http.Error(res, "no claims available", http.StatusUnauthorized)
-			return
-		}
-
-		username, ok := claims["user_id"].(string)
-		if !ok {
-			http.Error(res, "no required claims available", http.StatusUnauthorized)
+			writeProblem(res, req, err)
 			return
 		}
 
 		userID, err := bs.GetUserID(requestContext, username)
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusInternalServerError)
+			writeProblem(res, req, err)
 			return
 		}
 
 		var currentRequest transactionRequest
-		if err = json.NewDecoder(req.Body).Decode(&currentRequest); err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
+		if err = decodeJSON(req, &currentRequest); err != nil {
+			writeProblem(res, req, err)
 			return
 		}
 
 		if err = goluhn.Validate(currentRequest.Order); err != nil {
-			http.Error(res, err.Error(), http.StatusUnprocessableEntity)
+			writeProblem(res, req, fmt.Errorf("%w: %v", apperrors.ErrInvalidOrderNumber, err))
 			return
 		}
 
@@ -153,14 +120,7 @@ func HandleWithdrawBalance(bs BalanceStorage) http.HandlerFunc {
 
 		err = bs.WithdrawUserBalance(requestContext, &currentTransaction)
 		if err != nil {
-			switch err {
-			case apperrors.ErrInsufficientFunds:
-				http.Error(res, err.Error(), http.StatusPaymentRequired)
-			case apperrors.ErrOrderAlreadyExists:
-				http.Error(res, err.Error(), http.StatusUnprocessableEntity)
-			default:
-				http.Error(res, err.Error(), http.StatusInternalServerError)
-			}
+			writeProblem(res, req, err)
 			return
 		}
 
@@ -27,7 +27,7 @@ func TestHandleGetUserBalance(t *testing.T) {
 	_, tokenString, _ := tokenAuth.Encode(map[string]interface{}{"user_id": "test_user", "exp": time.Now().Add(5 * time.Second).Unix()})
 
 	r := http.NewServeMux()
-	r.Handle("/api/user/balance", jwtauth.Verifier(tokenAuth)(jwtauth.Authenticator(handler)))
+	r.Handle("/api/user/balance", jwtauth.Verifier(tokenAuth)(Authenticator(handler)))
 
 	ts := httptest.NewServer(r)
 	defer ts.Close()
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+)
+
+const (
+	jsonContentType = "application/json"
+	textContentType = "text/plain"
+)
+
+// Request body caps per route, after decompression.
+const (
+	maxAuthBodySize     = 4 << 10
+	maxOrderBodySize    = 256
+	maxWithdrawBodySize = 4 << 10
+	maxWebhookBodySize  = 16 << 10
+)
+
+// LimitBody rejects request bodies larger than maxSize with 413. Bodies
+// without a Content-Length are cut off while being read, see readBody.
+func LimitBody(maxSize int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if req.ContentLength > maxSize {
+				writeProblem(res, req, fmt.Errorf("%w: body exceeds %d bytes", apperrors.ErrRequestTooLarge, maxSize))
+				return
+			}
+			req.Body = http.MaxBytesReader(res, req.Body, maxSize)
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// RequireContentType rejects requests whose media type is not mediaType with
+// 415. Parameters such as charset are ignored.
+func RequireContentType(mediaType string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			contentType := req.Header.Get("Content-Type")
+			got, _, err := mime.ParseMediaType(contentType)
+			if err != nil || got != mediaType {
+				writeProblem(res, req, fmt.Errorf("%w: expected Content-Type %s, got %q", apperrors.ErrUnsupportedMediaType, mediaType, contentType))
+				return
+			}
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// readBody reads the whole request body, reporting a body cut off by
+// LimitBody as too large.
+func readBody(req *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, bodyError(err)
+	}
+	return body, nil
+}
+
+// decodeJSON decodes exactly one JSON value into v and rejects unknown
+// fields and anything following the value.
+func decodeJSON(req *http.Request, v any) error {
+	decoder := json.NewDecoder(req.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return bodyError(err)
+	}
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		if err != nil {
+			return bodyError(err)
+		}
+		return fmt.Errorf("%w: unexpected data after the JSON value", apperrors.ErrInvalidRequest)
+	}
+	return nil
+}
+
+func bodyError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return fmt.Errorf("%w: body exceeds %d bytes", apperrors.ErrRequestTooLarge, maxBytesErr.Limit)
+	}
+	return fmt.Errorf("%w: invalid request body: %v", apperrors.ErrInvalidRequest, err)
+}
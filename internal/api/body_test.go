@@ -0,0 +1,109 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrictJSONBody(t *testing.T) {
+	handler := RequireContentType(jsonContentType)(LimitBody(64)(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var body transactionRequest
+		if err := decodeJSON(req, &body); err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+	})))
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{
+			name:        "valid body",
+			contentType: "application/json",
+			body:        `{"order": "2377225624", "sum": 751}`,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "charset parameter",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"order": "2377225624", "sum": 751}`,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "unknown field",
+			contentType: "application/json",
+			body:        `{"order": "2377225624", "sum": 751, "currency": "RUB"}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "trailing value",
+			contentType: "application/json",
+			body:        `{"order": "2377225624", "sum": 751} {}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "trailing garbage",
+			contentType: "application/json",
+			body:        `{"order": "2377225624", "sum": 751}garbage`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "body too large",
+			contentType: "application/json",
+			body:        `{"order": "` + strings.Repeat("1", 100) + `", "sum": 751}`,
+			wantStatus:  http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:        "wrong content type",
+			contentType: "text/plain",
+			body:        `{"order": "2377225624", "sum": 751}`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name:       "missing content type",
+			body:       `{"order": "2377225624", "sum": 751}`,
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestLimitBodyWithoutContentLength(t *testing.T) {
+	handler := LimitBody(maxOrderBodySize)(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if _, err := readBody(req); err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/user/orders", strings.NewReader(strings.Repeat("1", maxOrderBodySize+1)))
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+)
+
+const (
+	// maxDecompressedBodySize caps what a compressed request body may expand
+	// to, so a small zip bomb cannot exhaust memory
+	maxDecompressedBodySize = 1 << 20
+	supportedEncodings      = "gzip, deflate"
+)
+
+// Decompress inflates gzip and deflate request bodies before they reach the
+// handlers, which therefore never see Content-Encoding. The body is inflated
+// up front, so a body exceeding maxSize is rejected with 413 before any
+// handler or the idempotency middleware reads it.
+func Decompress(maxSize int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			encoding := strings.ToLower(strings.TrimSpace(req.Header.Get("Content-Encoding")))
+			if encoding == "" || encoding == "identity" {
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			var (
+				reader io.ReadCloser
+				err    error
+			)
+			switch encoding {
+			case "gzip", "x-gzip":
+				reader, err = gzip.NewReader(req.Body)
+			case "deflate":
+				reader, err = zlib.NewReader(req.Body)
+			default:
+				res.Header().Set("Accept-Encoding", supportedEncodings)
+				writeProblem(res, req, fmt.Errorf("%w: content encoding %q is not supported", apperrors.ErrUnsupportedMediaType, encoding))
+				return
+			}
+			if err != nil {
+				writeProblem(res, req, fmt.Errorf("%w: malformed %s body: %v", apperrors.ErrInvalidRequest, encoding, err))
+				return
+			}
+			defer reader.Close()
+
+			body, err := io.ReadAll(io.LimitReader(reader, maxSize+1))
+			if err != nil {
+				writeProblem(res, req, fmt.Errorf("%w: malformed %s body: %v", apperrors.ErrInvalidRequest, encoding, err))
+				return
+			}
+			if int64(len(body)) > maxSize {
+				writeProblem(res, req, fmt.Errorf("%w: decompressed body exceeds %d bytes", apperrors.ErrRequestTooLarge, maxSize))
+				return
+			}
+
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.ContentLength = int64(len(body))
+			req.Header.Del("Content-Encoding")
+			req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+			next.ServeHTTP(res, req)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compressBody(t *testing.T, encoding string, body []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	default:
+		return body
+	}
+	_, err := w.Write(body)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	const maxSize = 1024
+	ts := httptest.NewServer(Decompress(maxSize)(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		res.Header().Set("X-Content-Encoding", req.Header.Get("Content-Encoding"))
+		res.Write(body)
+	})))
+	defer ts.Close()
+
+	order := []byte("12345678903")
+	tests := []struct {
+		name       string
+		encoding   string
+		body       []byte
+		wantStatus int
+		wantBody   []byte
+	}{
+		{
+			name:       "gzip",
+			encoding:   "gzip",
+			body:       compressBody(t, "gzip", order),
+			wantStatus: http.StatusOK,
+			wantBody:   order,
+		},
+		{
+			name:       "deflate",
+			encoding:   "deflate",
+			body:       compressBody(t, "deflate", order),
+			wantStatus: http.StatusOK,
+			wantBody:   order,
+		},
+		{
+			name:       "uncompressed",
+			body:       order,
+			wantStatus: http.StatusOK,
+			wantBody:   order,
+		},
+		{
+			name:       "unsupported encoding",
+			encoding:   "br",
+			body:       order,
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:       "malformed gzip",
+			encoding:   "gzip",
+			body:       order,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "expands beyond the limit",
+			encoding:   "gzip",
+			body:       compressBody(t, "gzip", bytes.Repeat([]byte("0"), 100*maxSize)),
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, ts.URL, bytes.NewReader(tt.body))
+			require.NoError(t, err)
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, tt.wantStatus, resp.StatusCode)
+			if tt.wantStatus != http.StatusOK {
+				assert.Equal(t, problemContentType, resp.Header.Get("Content-Type"))
+				if tt.wantStatus == http.StatusUnsupportedMediaType {
+					assert.Equal(t, supportedEncodings, resp.Header.Get("Accept-Encoding"))
+				}
+				return
+			}
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBody, body)
+			assert.Empty(t, resp.Header.Get("X-Content-Encoding"))
+		})
+	}
+}
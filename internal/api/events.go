@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+const (
+	eventsKeepAliveInterval = 15 * time.Second
+)
+
+type EventSubscriber interface {
+	Subscribe(userID int) (<-chan models.Event, func())
+}
+
+func HandleUserEvents(es EventSubscriber, us UserStorage) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		username, err := usernameFromContext(req.Context())
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		flusher, ok := res.(http.Flusher)
+		if !ok {
+			writeProblem(res, req, errors.New("streaming unsupported"))
+			return
+		}
+
+		requestContext, cancel := context.WithTimeout(req.Context(), requestTimeout)
+		userID, err := us.GetUserID(requestContext, username)
+		cancel()
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		events, unsubscribe := es.Subscribe(userID)
+		defer unsubscribe()
+
+		res.Header().Set("Content-Type", "text/event-stream")
+		res.Header().Set("Cache-Control", "no-cache")
+		res.Header().Set("Connection", "keep-alive")
+		res.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(eventsKeepAliveInterval)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-keepAlive.C:
+				if _, err = fmt.Fprint(res, ": keep-alive\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					logger.FromContext(req.Context()).Errorf("error encoding event: %v", err)
+					continue
+				}
+				if _, err = fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
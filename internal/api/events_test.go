@@ -0,0 +1,97 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/evgfitil/gophermart.git/internal/mocks"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+func TestHandleUserEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockEventSubscriber := mocks.NewMockEventSubscriber(ctrl)
+	mockUserStorage := mocks.NewMockUserStorage(ctrl)
+	handler := HandleUserEvents(mockEventSubscriber, mockUserStorage)
+
+	tokenAuth = jwtauth.New("HS256", []byte("jwtDefaultSecret"), nil)
+	_, tokenString, _ := tokenAuth.Encode(map[string]interface{}{"user_id": "test_user", "exp": time.Now().Add(5 * time.Second).Unix()})
+
+	r := http.NewServeMux()
+	r.Handle("/api/user/events", jwtauth.Verifier(tokenAuth)(Authenticator(handler)))
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	type want struct {
+		statusCode int
+		body       string
+	}
+	tests := []struct {
+		name       string
+		authHeader string
+		mockSetup  func()
+		want       want
+	}{
+		{
+			name:       "stream events",
+			authHeader: "Bearer " + tokenString,
+			mockSetup: func() {
+				events := make(chan models.Event, 2)
+				events <- models.Event{Type: models.EventTypeOrderStatus, UserID: 1, Order: "12345678903", Status: "PROCESSED", Accrual: 500}
+				events <- models.Event{Type: models.EventTypeBalance, UserID: 1, Balance: &models.Balance{Current: 500}}
+				close(events)
+				mockUserStorage.EXPECT().GetUserID(gomock.Any(), "test_user").Return(1, nil)
+				mockEventSubscriber.EXPECT().Subscribe(1).Return(events, func() {})
+			},
+			want: want{
+				statusCode: http.StatusOK,
+				body: "event: order_status\ndata: {\"type\":\"order_status\",\"order\":\"12345678903\",\"status\":\"PROCESSED\",\"accrual\":500}\n\n" +
+					"event: balance\ndata: {\"type\":\"balance\",\"balance\":{\"current\":500,\"withdrawn\":0}}\n\n",
+			},
+		},
+		{
+			name:       "unauthorized user",
+			authHeader: "",
+			mockSetup:  func() {},
+			want: want{
+				statusCode: http.StatusUnauthorized,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/user/events", nil)
+			require.NoError(t, err)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.want.statusCode, resp.StatusCode)
+
+			if tt.want.body != "" {
+				assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tt.want.body, string(body))
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/evgfitil/gophermart.git/internal/health"
+	"github.com/evgfitil/gophermart.git/internal/logger"
+)
+
+type HealthChecker interface {
+	Check(ctx context.Context) (health.Report, bool)
+}
+
+// HandleLiveness reports that the process is up and serving HTTP.
+func HandleLiveness() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(map[string]string{"status": health.StatusUp})
+	}
+}
+
+// HandleReadiness reports whether all dependencies are usable, with a report
+// per component. The endpoint is public, so the errors of failed components
+// are logged and only their status is reported.
+func HandleReadiness(hc HealthChecker) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		report, ready := hc.Check(req.Context())
+		components := make(map[string]health.ComponentReport, len(report.Components))
+		for name, component := range report.Components {
+			if component.Error != "" {
+				logger.FromContext(req.Context()).Warnf("health check %s failed: %s", name, component.Error)
+				component.Error = ""
+			}
+			components[name] = component
+		}
+		report.Components = components
+
+		res.Header().Set("Content-Type", "application/json")
+		res.Header().Set("Cache-Control", "no-store")
+		if !ready {
+			res.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(res).Encode(report)
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/evgfitil/gophermart.git/internal/health"
+	"github.com/evgfitil/gophermart.git/internal/mocks"
+)
+
+func TestHandleReadiness(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockHealthChecker := mocks.NewMockHealthChecker(ctrl)
+	ts := httptest.NewServer(HandleReadiness(mockHealthChecker))
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		report     health.Report
+		ready      bool
+		wantStatus int
+		want       health.Report
+	}{
+		{
+			name: "ready",
+			report: health.Report{
+				Status:     health.StatusUp,
+				Components: map[string]health.ComponentReport{"database": {Status: health.StatusUp}},
+			},
+			ready:      true,
+			wantStatus: http.StatusOK,
+			want: health.Report{
+				Status:     health.StatusUp,
+				Components: map[string]health.ComponentReport{"database": {Status: health.StatusUp}},
+			},
+		},
+		{
+			name: "dependency down",
+			report: health.Report{
+				Status:     health.StatusDown,
+				Components: map[string]health.ComponentReport{"database": {Status: health.StatusDown, Error: "connection refused"}},
+			},
+			ready:      false,
+			wantStatus: http.StatusServiceUnavailable,
+			// the error may name internal hosts and is only logged
+			want: health.Report{
+				Status:     health.StatusDown,
+				Components: map[string]health.ComponentReport{"database": {Status: health.StatusDown}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockHealthChecker.EXPECT().Check(gomock.Any()).Return(tt.report, tt.ready)
+
+			resp, err := ts.Client().Get(ts.URL)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			var report health.Report
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+			assert.Equal(t, tt.want, report)
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/jwtauth"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	idempotencyKeyMaxLength   = 255
+	idempotencyKeyTTL         = 24 * time.Hour
+	anonymousIdempotencyScope = "anonymous"
+)
+
+// replayedHeaders are the response headers stored together with the body.
+// Authorization is not among them, tokens are never written to the database.
+var replayedHeaders = []string{"Content-Type"}
+
+// replayHook adds to a replayed response what is not stored with it. body is
+// the request body, which is the same as the one of the original request.
+type replayHook func(res http.ResponseWriter, req *http.Request, body []byte, stored *models.IdempotencyRecord) error
+
+type IdempotencyStorage interface {
+	DeleteIdempotencyKey(ctx context.Context, scope string, key string) error
+	ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord, ttl time.Duration) (*models.IdempotencyRecord, bool, error)
+	SaveIdempotencyResponse(ctx context.Context, record *models.IdempotencyRecord) error
+}
+
+// responseRecorder passes the response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(statusCode int) {
+	if rr.statusCode == 0 {
+		rr.statusCode = statusCode
+	}
+	rr.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.statusCode == 0 {
+		rr.statusCode = http.StatusOK
+	}
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+func idempotencyScope(req *http.Request) string {
+	_, claims, err := jwtauth.FromContext(req.Context())
+	if err != nil || claims == nil {
+		return anonymousIdempotencyScope
+	}
+	if username, ok := claims["user_id"].(string); ok {
+		return "user:" + username
+	}
+	return anonymousIdempotencyScope
+}
+
+func requestHash(req *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(req.Method + " " + req.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func replayResponse(res http.ResponseWriter, record *models.IdempotencyRecord) {
+	for name, values := range record.Header {
+		for _, value := range values {
+			res.Header().Add(name, value)
+		}
+	}
+	res.Header().Set(idempotencyReplayedHeader, "true")
+	res.WriteHeader(record.StatusCode)
+	res.Write(record.Body)
+}
+
+// Idempotency makes POST handlers safe to retry. The first response for an
+// Idempotency-Key is stored and replayed for later requests with the same key
+// and body. Server errors are not stored, so the client may retry them.
+func Idempotency(is IdempotencyStorage) func(http.Handler) http.Handler {
+	return idempotency(is, nil)
+}
+
+// IdempotentRegistration is Idempotency for registration. A replayed
+// registration gets a freshly issued token, since the original one is not
+// stored.
+func IdempotentRegistration(is IdempotencyStorage) func(http.Handler) http.Handler {
+	return idempotency(is, reissueToken)
+}
+
+// reissueToken issues a token to the user a successful registration created.
+// The replayed body holds the same login and password, so the caller is the
+// one who registered.
+func reissueToken(res http.ResponseWriter, _ *http.Request, body []byte, stored *models.IdempotencyRecord) error {
+	if stored.StatusCode != http.StatusOK {
+		return nil
+	}
+	var user models.User
+	if err := json.Unmarshal(body, &user); err != nil {
+		return fmt.Errorf("error decoding replayed registration: %w", err)
+	}
+	tokenString, err := generateToken(user.Username)
+	if err != nil {
+		return fmt.Errorf("failed to generate auth token: %w", err)
+	}
+	res.Header().Set("Authorization", "Bearer "+tokenString)
+	return nil
+}
+
+func idempotency(is IdempotencyStorage, onReplay replayHook) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			key := req.Header.Get(idempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(res, req)
+				return
+			}
+			if len(key) > idempotencyKeyMaxLength {
+				writeProblem(res, req, fmt.Errorf("%w: idempotency key is too long", apperrors.ErrInvalidRequest))
+				return
+			}
+
+			body, err := readBody(req)
+			if err != nil {
+				writeProblem(res, req, err)
+				return
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			requestContext, cancel := context.WithTimeout(req.Context(), requestTimeout)
+			defer cancel()
+
+			record := &models.IdempotencyRecord{
+				Scope:       idempotencyScope(req),
+				Key:         key,
+				RequestHash: requestHash(req, body),
+			}
+			stored, reserved, err := is.ReserveIdempotencyKey(requestContext, record, idempotencyKeyTTL)
+			if err != nil {
+				writeProblem(res, req, err)
+				return
+			}
+			if !reserved {
+				switch {
+				case stored.RequestHash != record.RequestHash:
+					writeProblem(res, req, apperrors.ErrIdempotencyKeyReused)
+				case stored.StatusCode == 0:
+					writeProblem(res, req, apperrors.ErrIdempotencyKeyInProgress)
+				default:
+					if onReplay != nil {
+						if err = onReplay(res, req, body, stored); err != nil {
+							writeProblem(res, req, err)
+							return
+						}
+					}
+					replayResponse(res, stored)
+				}
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: res}
+			next.ServeHTTP(recorder, req)
+
+			// the client may have gone away, which is exactly when the
+			// response has to be stored for its retry
+			saveContext, saveCancel := context.WithTimeout(context.WithoutCancel(req.Context()), requestTimeout)
+			defer saveCancel()
+
+			if recorder.statusCode == 0 || recorder.statusCode >= http.StatusInternalServerError {
+				if err = is.DeleteIdempotencyKey(saveContext, record.Scope, record.Key); err != nil {
+					logger.FromContext(req.Context()).Errorf("error releasing idempotency key: %v", err)
+				}
+				return
+			}
+
+			record.StatusCode = recorder.statusCode
+			record.Body = recorder.body.Bytes()
+			record.Header = make(http.Header)
+			for _, name := range replayedHeaders {
+				if values := recorder.Header().Values(name); len(values) > 0 {
+					record.Header[name] = values
+				}
+			}
+			if err = is.SaveIdempotencyResponse(saveContext, record); err != nil {
+				logger.FromContext(req.Context()).Errorf("error saving idempotent response: %v", err)
+			}
+		})
+	}
+}
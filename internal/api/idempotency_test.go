@@ -0,0 +1,202 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/evgfitil/gophermart.git/internal/mocks"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+func TestIdempotency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockIdempotencyStorage := mocks.NewMockIdempotencyStorage(ctrl)
+
+	handlerCalls := 0
+	handlerStatus := http.StatusAccepted
+	handler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		handlerCalls++
+		res.Header().Set("Content-Type", "text/plain")
+		res.WriteHeader(handlerStatus)
+		res.Write([]byte("upload in successfully"))
+	})
+
+	ts := httptest.NewServer(Idempotency(mockIdempotencyStorage)(handler))
+	defer ts.Close()
+
+	body := "12345678903"
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	hash := requestHash(req, []byte(body))
+
+	type want struct {
+		statusCode   int
+		body         string
+		replayed     bool
+		handlerCalls int
+	}
+	tests := []struct {
+		name           string
+		idempotencyKey string
+		handlerStatus  int
+		mockSetup      func()
+		want           want
+	}{
+		{
+			name:           "no idempotency key",
+			idempotencyKey: "",
+			mockSetup:      func() {},
+			want:           want{statusCode: http.StatusAccepted, body: "upload in successfully", handlerCalls: 1},
+		},
+		{
+			name:           "first request is stored",
+			idempotencyKey: "key-1",
+			mockSetup: func() {
+				mockIdempotencyStorage.EXPECT().ReserveIdempotencyKey(gomock.Any(), gomock.Any(), idempotencyKeyTTL).DoAndReturn(
+					func(_ any, record *models.IdempotencyRecord, _ any) (*models.IdempotencyRecord, bool, error) {
+						assert.Equal(t, anonymousIdempotencyScope, record.Scope)
+						assert.Equal(t, hash, record.RequestHash)
+						return record, true, nil
+					})
+				mockIdempotencyStorage.EXPECT().SaveIdempotencyResponse(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ any, record *models.IdempotencyRecord) error {
+						assert.Equal(t, http.StatusAccepted, record.StatusCode)
+						assert.Equal(t, "upload in successfully", string(record.Body))
+						assert.Equal(t, "text/plain", record.Header.Get("Content-Type"))
+						return nil
+					})
+			},
+			want: want{statusCode: http.StatusAccepted, body: "upload in successfully", handlerCalls: 1},
+		},
+		{
+			name:           "replay stored response",
+			idempotencyKey: "key-1",
+			mockSetup: func() {
+				mockIdempotencyStorage.EXPECT().ReserveIdempotencyKey(gomock.Any(), gomock.Any(), idempotencyKeyTTL).Return(
+					&models.IdempotencyRecord{RequestHash: hash, StatusCode: http.StatusAccepted, Body: []byte("upload in successfully")}, false, nil)
+			},
+			want: want{statusCode: http.StatusAccepted, body: "upload in successfully", replayed: true},
+		},
+		{
+			name:           "key reused with different body",
+			idempotencyKey: "key-1",
+			mockSetup: func() {
+				mockIdempotencyStorage.EXPECT().ReserveIdempotencyKey(gomock.Any(), gomock.Any(), idempotencyKeyTTL).Return(
+					&models.IdempotencyRecord{RequestHash: "other", StatusCode: http.StatusAccepted}, false, nil)
+			},
+			want: want{statusCode: http.StatusUnprocessableEntity},
+		},
+		{
+			name:           "original request in progress",
+			idempotencyKey: "key-1",
+			mockSetup: func() {
+				mockIdempotencyStorage.EXPECT().ReserveIdempotencyKey(gomock.Any(), gomock.Any(), idempotencyKeyTTL).Return(
+					&models.IdempotencyRecord{RequestHash: hash}, false, nil)
+			},
+			want: want{statusCode: http.StatusConflict},
+		},
+		{
+			name:           "server error releases key",
+			idempotencyKey: "key-2",
+			handlerStatus:  http.StatusInternalServerError,
+			mockSetup: func() {
+				mockIdempotencyStorage.EXPECT().ReserveIdempotencyKey(gomock.Any(), gomock.Any(), idempotencyKeyTTL).DoAndReturn(
+					func(_ any, record *models.IdempotencyRecord, _ any) (*models.IdempotencyRecord, bool, error) {
+						return record, true, nil
+					})
+				mockIdempotencyStorage.EXPECT().DeleteIdempotencyKey(gomock.Any(), anonymousIdempotencyScope, "key-2").Return(nil)
+			},
+			want: want{statusCode: http.StatusInternalServerError, body: "upload in successfully", handlerCalls: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			handlerCalls = 0
+			handlerStatus = http.StatusAccepted
+			if tt.handlerStatus != 0 {
+				handlerStatus = tt.handlerStatus
+			}
+
+			req, err := http.NewRequest(http.MethodPost, ts.URL+"/", bytes.NewBufferString(body))
+			require.NoError(t, err)
+			if tt.idempotencyKey != "" {
+				req.Header.Set(idempotencyKeyHeader, tt.idempotencyKey)
+			}
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.want.statusCode, resp.StatusCode)
+			assert.Equal(t, tt.want.handlerCalls, handlerCalls)
+			assert.Equal(t, tt.want.replayed, resp.Header.Get(idempotencyReplayedHeader) == "true")
+			if tt.want.body != "" {
+				respBody, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tt.want.body, string(respBody))
+			}
+		})
+	}
+}
+
+func TestIdempotentRegistration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockIdempotencyStorage := mocks.NewMockIdempotencyStorage(ctrl)
+	handler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Authorization", "Bearer original")
+		res.Write([]byte("User registered successfully"))
+	})
+	ts := httptest.NewServer(IdempotentRegistration(mockIdempotencyStorage)(handler))
+	defer ts.Close()
+
+	body := `{"login":"user","password":"secret"}`
+	var stored *models.IdempotencyRecord
+	mockIdempotencyStorage.EXPECT().ReserveIdempotencyKey(gomock.Any(), gomock.Any(), idempotencyKeyTTL).DoAndReturn(
+		func(_ any, record *models.IdempotencyRecord, _ any) (*models.IdempotencyRecord, bool, error) {
+			return record, true, nil
+		})
+	mockIdempotencyStorage.EXPECT().SaveIdempotencyResponse(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ any, record *models.IdempotencyRecord) error {
+			stored = record
+			return nil
+		})
+	mockIdempotencyStorage.EXPECT().ReserveIdempotencyKey(gomock.Any(), gomock.Any(), idempotencyKeyTTL).DoAndReturn(
+		func(_ any, _ *models.IdempotencyRecord, _ any) (*models.IdempotencyRecord, bool, error) {
+			return stored, false, nil
+		})
+
+	register := func() *http.Response {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		req.Header.Set(idempotencyKeyHeader, "key-1")
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := register()
+	assert.Equal(t, "Bearer original", resp.Header.Get("Authorization"))
+	require.NotNil(t, stored)
+	assert.Empty(t, stored.Header.Values("Authorization"), "tokens must not be stored")
+
+	resp = register()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "true", resp.Header.Get(idempotencyReplayedHeader))
+	token, err := tokenAuth.Decode(strings.TrimPrefix(resp.Header.Get("Authorization"), "Bearer "))
+	require.NoError(t, err)
+	assert.Equal(t, "user", token.PrivateClaims()["user_id"])
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+const (
+	defaultJobRunsLimit = 20
+	maxJobRunsLimit     = 500
+)
+
+type JobScheduler interface {
+	JobRuns(ctx context.Context, name string, limit int) ([]models.JobRun, error)
+	Jobs(ctx context.Context) ([]models.JobInfo, error)
+	TriggerJob(ctx context.Context, name string) (*models.JobRun, error)
+}
+
+func HandleGetJobs(js JobScheduler) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		requestContext, cancel := context.WithTimeout(req.Context(), requestTimeout)
+		defer cancel()
+
+		jobs, err := js.Jobs(requestContext)
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		if len(jobs) == 0 {
+			res.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(jobs)
+	}
+}
+
+// HandleTriggerJob queues a manual run of the job. The run is accepted
+// rather than done, its outcome shows up in the runs of the job.
+func HandleTriggerJob(js JobScheduler) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		requestContext, cancel := context.WithTimeout(req.Context(), requestTimeout)
+		defer cancel()
+
+		run, err := js.TriggerJob(requestContext, chi.URLParam(req, "name"))
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(res).Encode(run)
+	}
+}
+
+func HandleGetJobRuns(js JobScheduler) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		requestContext, cancel := context.WithTimeout(req.Context(), requestTimeout)
+		defer cancel()
+
+		limit, err := queryLimit(req, defaultJobRunsLimit, maxJobRunsLimit)
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		runs, err := js.JobRuns(requestContext, chi.URLParam(req, "name"), limit)
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		if len(runs) == 0 {
+			res.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(runs)
+	}
+}
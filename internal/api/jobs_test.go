@@ -0,0 +1,110 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+	"github.com/evgfitil/gophermart.git/internal/mocks"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+func TestHandleAdminJobs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockJobScheduler := mocks.NewMockJobScheduler(ctrl)
+
+	r := chi.NewRouter()
+	r.With(RequireAdmin("admin-secret")).Route("/api/admin/jobs", func(r chi.Router) {
+		r.Get("/", HandleGetJobs(mockJobScheduler))
+		r.Post("/{name}/run", HandleTriggerJob(mockJobScheduler))
+		r.Get("/{name}/runs", HandleGetJobRuns(mockJobScheduler))
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	tests := []struct {
+		name          string
+		requestMethod string
+		path          string
+		mockSetup     func()
+		wantStatus    int
+	}{
+		{
+			name:          "list jobs",
+			requestMethod: http.MethodGet,
+			path:          "/api/admin/jobs",
+			mockSetup: func() {
+				mockJobScheduler.EXPECT().Jobs(gomock.Any()).Return([]models.JobInfo{
+					{Name: "accrual_poll", Schedule: "@every 10s", Timeout: "1m0s"},
+				}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "trigger job",
+			requestMethod: http.MethodPost,
+			path:          "/api/admin/jobs/accrual_poll/run",
+			mockSetup: func() {
+				mockJobScheduler.EXPECT().TriggerJob(gomock.Any(), "accrual_poll").Return(&models.JobRun{
+					ID: 1, Job: "accrual_poll", Trigger: models.JobTriggerManual, Status: models.JobRunPending, CreatedAt: time.Now(),
+				}, nil)
+			},
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:          "trigger unknown job",
+			requestMethod: http.MethodPost,
+			path:          "/api/admin/jobs/missing/run",
+			mockSetup: func() {
+				mockJobScheduler.EXPECT().TriggerJob(gomock.Any(), "missing").Return(nil, apperrors.ErrJobNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:          "job runs",
+			requestMethod: http.MethodGet,
+			path:          "/api/admin/jobs/accrual_poll/runs?limit=5",
+			mockSetup: func() {
+				mockJobScheduler.EXPECT().JobRuns(gomock.Any(), "accrual_poll", 5).Return([]models.JobRun{
+					{ID: 1, Job: "accrual_poll", Trigger: models.JobTriggerSchedule, Status: models.JobRunSucceeded, CreatedAt: time.Now()},
+				}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "no job runs",
+			requestMethod: http.MethodGet,
+			path:          "/api/admin/jobs/job_runs_cleanup/runs",
+			mockSetup: func() {
+				mockJobScheduler.EXPECT().JobRuns(gomock.Any(), "job_runs_cleanup", defaultJobRunsLimit).Return([]models.JobRun{}, nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			req, err := http.NewRequest(tt.requestMethod, ts.URL+tt.path, nil)
+			require.NoError(t, err)
+			req.Header.Set(adminTokenHeader, "admin-secret")
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/evgfitil/gophermart.git/internal/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Metrics)
+	r.Get("/api/user/webhooks/{id}", func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusNoContent)
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		path   string
+		route  string
+		status string
+	}{
+		{
+			name:   "labelled by route pattern",
+			path:   "/api/user/webhooks/42",
+			route:  "/api/user/webhooks/{id}",
+			status: "204",
+		},
+		{
+			name:   "unmatched route",
+			path:   "/unknown",
+			route:  "unmatched",
+			status: "404",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := metrics.HTTPRequestsTotal.WithLabelValues(http.MethodGet, tt.route, tt.status)
+			before := testutil.ToFloat64(counter)
+
+			resp, err := ts.Client().Get(ts.URL + tt.path)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, before+1, testutil.ToFloat64(counter))
+		})
+	}
+}
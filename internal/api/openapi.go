@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+	"github.com/evgfitil/gophermart.git/internal/logger"
+)
+
+// openAPISpec documents every route of Router. TestOpenAPICoversRoutes fails
+// when a route is added without a spec entry.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func HandleOpenAPI() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(openAPISpec)
+	}
+}
+
+func loadOpenAPI() (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing OpenAPI document: %w", err)
+	}
+	if err = doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	return doc, nil
+}
+
+// OpenAPIValidator rejects requests that do not match the OpenAPI document
+// with 400 and logs responses that do not match it. Authentication is left
+// to Authenticator, which Router applies first, and requests to undocumented
+// routes are passed through.
+func OpenAPIValidator() (func(http.Handler) http.Handler, error) {
+	doc, err := loadOpenAPI()
+	if err != nil {
+		return nil, err
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error creating OpenAPI router: %w", err)
+	}
+	options := &openapi3filter.Options{
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+	// keep problem details short, without the schema and the value
+	options.WithCustomSchemaErrorFunc(func(err *openapi3.SchemaError) string {
+		return err.Reason
+	})
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			route, pathParams, err := router.FindRoute(req)
+			if err != nil {
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			if body := route.Operation.RequestBody; body != nil && body.Value != nil {
+				if body.Value.Content.Get(req.Header.Get("Content-Type")) == nil {
+					writeProblem(res, req, fmt.Errorf("%w: Content-Type %q is not accepted", apperrors.ErrUnsupportedMediaType, req.Header.Get("Content-Type")))
+					return
+				}
+			}
+
+			// routes without LimitBody are still bounded while the body is read
+			req.Body = http.MaxBytesReader(res, req.Body, maxDecompressedBodySize)
+			requestInput := &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    options,
+			}
+			if err = openapi3filter.ValidateRequest(req.Context(), requestInput); err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					writeProblem(res, req, bodyError(err))
+				} else {
+					writeProblem(res, req, fmt.Errorf("%w: %v", apperrors.ErrInvalidRequest, err))
+				}
+				return
+			}
+
+			if streamsResponse(route) {
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			var body bytes.Buffer
+			ww := middleware.NewWrapResponseWriter(res, req.ProtoMajor)
+			ww.Tee(&body)
+			next.ServeHTTP(ww, req)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			responseInput := &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: requestInput,
+				Status:                 status,
+				Header:                 ww.Header(),
+				Options:                options,
+			}
+			responseInput.SetBodyBytes(body.Bytes())
+			if err = openapi3filter.ValidateResponse(req.Context(), responseInput); err != nil {
+				logger.FromContext(req.Context()).Errorf("response does not match the OpenAPI document: %v", err)
+			}
+		})
+	}, nil
+}
+
+// streamsResponse reports whether the operation answers with an event
+// stream, whose response is not validated.
+func streamsResponse(route *routers.Route) bool {
+	response := route.Operation.Responses.Status(http.StatusOK)
+	return response != nil && response.Value != nil && response.Value.Content.Get("text/event-stream") != nil
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	doc, err := loadOpenAPI()
+	require.NoError(t, err)
+
+	routes := make(map[string]bool)
+	router := Router(Dependencies{})
+	err = chi.Walk(router, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if route != "/" {
+			route = strings.TrimSuffix(route, "/")
+		}
+		routes[method+" "+route] = true
+
+		path := doc.Paths.Find(route)
+		if assert.NotNil(t, path, "route %s has no OpenAPI path", route) {
+			assert.NotNil(t, path.GetOperation(method), "route %s %s has no OpenAPI operation", method, route)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			assert.True(t, routes[method+" "+path], "OpenAPI operation %s %s has no route", method, path)
+		}
+	}
+}
+
+func TestHandleOpenAPI(t *testing.T) {
+	rec := httptest.NewRecorder()
+	HandleOpenAPI()(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, string(openAPISpec), rec.Body.String())
+}
+
+func TestOpenAPIValidator(t *testing.T) {
+	validator, err := OpenAPIValidator()
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Use(validator)
+	r.Post("/api/user/balance/withdraw", func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{
+			name:       "valid request",
+			body:       `{"order": "2377225624", "sum": 751}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "wrong type",
+			body:       `{"order": "2377225624", "sum": "751"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing field",
+			body:       `{"order": "2377225624"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "undocumented content type",
+			contentType: "text/plain",
+			body:        `{"order": "2377225624", "sum": 751}`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType := tt.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			resp, err := ts.Client().Post(ts.URL+"/api/user/balance/withdraw", contentType, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestRouterValidatesAfterAuthentication(t *testing.T) {
+	validator, err := OpenAPIValidator()
+	require.NoError(t, err)
+	router := Router(Dependencies{Validator: validator})
+	_, tokenString, _ := tokenAuth.Encode(map[string]interface{}{"user_id": "test_user", "exp": time.Now().Add(5 * time.Second).Unix()})
+
+	tests := []struct {
+		name       string
+		authHeader string
+		wantStatus int
+	}{
+		{name: "unauthenticated", wantStatus: http.StatusUnauthorized},
+		{name: "authenticated", authHeader: "Bearer " + tokenString, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(`{"order": "2377225624", "sum": "751"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusUnauthorized {
+				assert.NotContains(t, rec.Body.String(), "sum")
+			}
+		})
+	}
+}
@@ -3,12 +3,12 @@ package api
 import (
 	"context"
 	"encoding/json"
-	"io"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/ShiraazMoollatjie/goluhn"
-	"github.com/go-chi/jwtauth"
 
 	"github.com/evgfitil/gophermart.git/internal/apperrors"
 	"github.com/evgfitil/gophermart.git/internal/models"
@@ -24,32 +24,26 @@ func HandleGetUserOrders(os OrderStorage, us UserStorage) http.HandlerFunc {
 		requestContext, cancel := context.WithTimeout(req.Context(), requestTimeout)
 		defer cancel()
 
-		_, claims, err := jwtauth.FromContext(requestContext)
+		username, err := usernameFromContext(requestContext)
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		if claims == nil {
-			http.Error(res, "no claims available", http.StatusUnauthorized)
-			return
-		}
-
-		username, ok := claims["user_id"].(string)
-		if !ok {
-			http.Error(res, "No required claim available", http.StatusUnauthorized)
+			writeProblem(res, req, err)
 			return
 		}
 
 		userID, err := us.GetUserID(requestContext, username)
 		if err != nil {
-			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			writeProblem(res, req, err)
 			return
 		}
 
 		userOrders, err := os.GetOrders(requestContext, userID)
 		if err != nil {
-			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			writeProblem(res, req, err)
+			return
+		}
+		if len(userOrders) == 0 {
+			res.WriteHeader(http.StatusNoContent)
+			return
 		}
 		res.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(res).Encode(userOrders)
@@ -61,45 +55,33 @@ func HandleUploadOrder(os OrderStorage, us UserStorage) http.HandlerFunc {
 		requestContext, cancel := context.WithTimeout(req.Context(), requestTimeout)
 		defer cancel()
 
-		_, claims, err := jwtauth.FromContext(requestContext)
+		username, err := usernameFromContext(requestContext)
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		if claims == nil {
-			http.Error(res, "no claims available", http.StatusUnauthorized)
-			return
-		}
-
-		username, ok := claims["user_id"].(string)
-		if !ok {
-			http.Error(res, "No required claim available", http.StatusUnauthorized)
+			writeProblem(res, req, err)
 			return
 		}
 
-		body, err := io.ReadAll(req.Body)
-		defer req.Body.Close()
-
+		body, err := readBody(req)
 		if err != nil {
-			http.Error(res, "failed to read the request body", http.StatusInternalServerError)
+			writeProblem(res, req, err)
 			return
 		}
 
 		orderNumber := string(body)
 		if orderNumber == "" {
-			http.Error(res, "empty orderNumber", http.StatusUnprocessableEntity)
+			writeProblem(res, req, fmt.Errorf("%w: empty order number", apperrors.ErrInvalidOrderNumber))
 			return
 		}
 		if err = goluhn.Validate(orderNumber); err != nil {
-			http.Error(res, err.Error(), http.StatusUnprocessableEntity)
+			writeProblem(res, req, fmt.Errorf("%w: %v", apperrors.ErrInvalidOrderNumber, err))
 			return
 		}
 
 		var userID int
 		userID, err = us.GetUserID(requestContext, username)
 		if err != nil {
-			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			writeProblem(res, req, err)
+			return
 		}
 
 		order := models.Order{
@@ -110,17 +92,13 @@ func HandleUploadOrder(os OrderStorage, us UserStorage) http.HandlerFunc {
 		}
 
 		if err = os.ProcessOrder(requestContext, order); err != nil {
-			switch err {
-			case apperrors.ErrOrderAlreadyExists:
-				http.Error(res, "order already exists", http.StatusOK)
-				return
-			case apperrors.ErrOrderNumberTaken:
-				http.Error(res, err.Error(), http.StatusConflict)
-				return
-			default:
-				http.Error(res, "internal server error", http.StatusInternalServerError)
+			if errors.Is(err, apperrors.ErrOrderAlreadyExists) {
+				res.WriteHeader(http.StatusOK)
+				res.Write([]byte("order already exists"))
 				return
 			}
+			writeProblem(res, req, err)
+			return
 		}
 
 		res.WriteHeader(http.StatusAccepted)
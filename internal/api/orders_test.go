@@ -31,7 +31,7 @@ func TestHandleGetUserOrders(t *testing.T) {
 	_, tokenString, _ := tokenAuth.Encode(map[string]interface{}{"user_id": "test_user", "exp": time.Now().Add(5 * time.Second).Unix()})
 
 	r := http.NewServeMux()
-	r.Handle("/api/user/orders", jwtauth.Verifier(tokenAuth)(jwtauth.Authenticator(handler)))
+	r.Handle("/api/user/orders", jwtauth.Verifier(tokenAuth)(Authenticator(handler)))
 
 	ts := httptest.NewServer(r)
 	defer ts.Close()
@@ -64,6 +64,19 @@ func TestHandleGetUserOrders(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:          "no orders",
+			requestMethod: http.MethodGet,
+			authHeader:    "Bearer " + tokenString,
+			mockSetup: func() {
+				mockUserStorage.EXPECT().GetUserID(gomock.Any(), "test_user").Return(1, nil)
+				mockOrderStorage.EXPECT().GetOrders(gomock.Any(), 1).Return(nil, nil)
+			},
+			want: want{
+				statusCode: http.StatusNoContent,
+				orders:     nil,
+			},
+		},
 		{
 			name:          "unauthorized user",
 			requestMethod: http.MethodGet,
@@ -131,7 +144,7 @@ func TestHandleUploadOrder(t *testing.T) {
 	_, tokenString, _ := tokenAuth.Encode(map[string]interface{}{"user_id": "test_user", "exp": time.Now().Add(5 * time.Second).Unix()})
 
 	r := http.NewServeMux()
-	r.Handle("/api/user/orders", jwtauth.Verifier(tokenAuth)(jwtauth.Authenticator(handler)))
+	r.Handle("/api/user/orders", jwtauth.Verifier(tokenAuth)(Authenticator(handler)))
 
 	ts := httptest.NewServer(r)
 	defer ts.Close()
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+	"github.com/evgfitil/gophermart.git/internal/logger"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:gophermart:problem:"
+	internalErrorCode  = "internal_error"
+)
+
+// Problem is an RFC 7807 error response. Code is a stable machine-readable
+// identifier, Type is the same identifier as a URI.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+}
+
+type problemKind struct {
+	err    error
+	status int
+	code   string
+	title  string
+}
+
+// problemKinds maps application errors to responses. Errors that match none
+// of them are reported as internal errors without any detail.
+var problemKinds = []problemKind{
+	{apperrors.ErrInvalidRequest, http.StatusBadRequest, "invalid_request", "Invalid request"},
+	{apperrors.ErrUnauthorized, http.StatusUnauthorized, "unauthorized", "Unauthorized"},
+	{apperrors.ErrInvalidCredentials, http.StatusUnauthorized, "invalid_credentials", "Invalid credentials"},
+	{apperrors.ErrInsufficientFunds, http.StatusPaymentRequired, "insufficient_funds", "Insufficient funds"},
+	{apperrors.ErrNotFound, http.StatusNotFound, "not_found", "Not found"},
+	{apperrors.ErrWebhookNotFound, http.StatusNotFound, "webhook_not_found", "Webhook not found"},
+	{apperrors.ErrOrderNotFound, http.StatusNotFound, "order_not_found", "Order not found"},
+	{apperrors.ErrJobNotFound, http.StatusNotFound, "job_not_found", "Job not found"},
+	{apperrors.ErrMethodNotAllowed, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed"},
+	{apperrors.ErrUserAlreadyExists, http.StatusConflict, "user_already_exists", "User already exists"},
+	{apperrors.ErrOrderNumberTaken, http.StatusConflict, "order_number_taken", "Order number taken"},
+	{apperrors.ErrIdempotencyKeyInProgress, http.StatusConflict, "idempotency_key_in_progress", "Request in progress"},
+	{apperrors.ErrRequestTooLarge, http.StatusRequestEntityTooLarge, "request_too_large", "Request too large"},
+	{apperrors.ErrUnsupportedMediaType, http.StatusUnsupportedMediaType, "unsupported_media_type", "Unsupported media type"},
+	{apperrors.ErrInvalidOrderNumber, http.StatusUnprocessableEntity, "invalid_order_number", "Invalid order number"},
+	{apperrors.ErrOrderAlreadyExists, http.StatusUnprocessableEntity, "order_already_exists", "Order already exists"},
+	{apperrors.ErrIdempotencyKeyReused, http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency key reused"},
+	{apperrors.ErrRateLimited, http.StatusTooManyRequests, "rate_limited", "Too many requests"},
+}
+
+func newProblem(req *http.Request, err error) Problem {
+	for _, kind := range problemKinds {
+		if errors.Is(err, kind.err) {
+			return Problem{
+				Type:     problemTypePrefix + kind.code,
+				Title:    kind.title,
+				Status:   kind.status,
+				Detail:   err.Error(),
+				Instance: req.URL.Path,
+				Code:     kind.code,
+			}
+		}
+	}
+	return Problem{
+		Type:     problemTypePrefix + internalErrorCode,
+		Title:    http.StatusText(http.StatusInternalServerError),
+		Status:   http.StatusInternalServerError,
+		Instance: req.URL.Path,
+		Code:     internalErrorCode,
+	}
+}
+
+// writeProblem is the single place handlers and middlewares report errors
+// through. Internal errors are logged and never sent to the client.
+func writeProblem(res http.ResponseWriter, req *http.Request, err error) {
+	problem := newProblem(req, err)
+	if problem.Status == http.StatusInternalServerError {
+		logger.FromContext(req.Context()).Errorf("%s %s: %v", req.Method, req.URL.Path, err)
+	}
+
+	res.Header().Set("Content-Type", problemContentType)
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	res.WriteHeader(problem.Status)
+	json.NewEncoder(res).Encode(problem)
+}
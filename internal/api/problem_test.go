@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+)
+
+func TestWriteProblem(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Problem
+	}{
+		{
+			name: "application error",
+			err:  apperrors.ErrInsufficientFunds,
+			want: Problem{
+				Type:     "urn:gophermart:problem:insufficient_funds",
+				Title:    "Insufficient funds",
+				Status:   http.StatusPaymentRequired,
+				Detail:   "insufficient funds",
+				Instance: "/api/user/balance/withdraw",
+				Code:     "insufficient_funds",
+			},
+		},
+		{
+			name: "wrapped application error",
+			err:  fmt.Errorf("%w: password is required", apperrors.ErrInvalidRequest),
+			want: Problem{
+				Type:     "urn:gophermart:problem:invalid_request",
+				Title:    "Invalid request",
+				Status:   http.StatusBadRequest,
+				Detail:   "invalid request: password is required",
+				Instance: "/api/user/balance/withdraw",
+				Code:     "invalid_request",
+			},
+		},
+		{
+			name: "internal error is not exposed",
+			err:  errors.New(`pq: relation "transactions" does not exist`),
+			want: Problem{
+				Type:     "urn:gophermart:problem:internal_error",
+				Title:    "Internal Server Error",
+				Status:   http.StatusInternalServerError,
+				Instance: "/api/user/balance/withdraw",
+				Code:     "internal_error",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", nil)
+			rec := httptest.NewRecorder()
+
+			writeProblem(rec, req, tt.err)
+
+			assert.Equal(t, tt.want.Status, rec.Code)
+			assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+
+			var problem Problem
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&problem))
+			assert.Equal(t, tt.want, problem)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/ratelimit"
+)
+
+// Route names rate limits are configured by.
+const (
+	RateLimitRegister     = "register"
+	RateLimitLogin        = "login"
+	RateLimitOrdersUpload = "orders_upload"
+	RateLimitOrders       = "orders"
+	RateLimitBalance      = "balance"
+	RateLimitWithdraw     = "withdraw"
+	RateLimitWithdrawals  = "withdrawals"
+	RateLimitWebhooks     = "webhooks"
+	RateLimitEvents       = "events"
+)
+
+// RateLimits configures per-route rate limiting. Routes without an entry in
+// Routes are not limited. Anonymous requests are counted per client IP, which
+// is taken from X-Forwarded-For only when the peer is one of TrustedProxies.
+type RateLimits struct {
+	Store          ratelimit.Store
+	Routes         map[string]ratelimit.Limit
+	TrustedProxies []netip.Prefix
+}
+
+// limit returns a middleware counting requests to the named route per user
+// for authenticated requests and per client IP otherwise. If the store fails
+// the request is let through.
+func (rl RateLimits) limit(route string) func(http.Handler) http.Handler {
+	limit, ok := rl.Routes[route]
+	if rl.Store == nil || !ok {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			subject := "ip:" + rl.clientIP(req)
+			if username, err := usernameFromContext(req.Context()); err == nil {
+				subject = "user:" + username
+			}
+
+			result, err := rl.Store.Allow(req.Context(), route+":"+subject, limit)
+			if err != nil {
+				logger.FromContext(req.Context()).Errorf("error checking rate limit: %v", err)
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			res.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			res.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			res.Header().Set("RateLimit-Reset", ceilSeconds(result.Reset))
+			res.Header().Set("RateLimit-Policy", strconv.Itoa(limit.Requests)+";w="+ceilSeconds(limit.Window))
+			if !result.Allowed {
+				res.Header().Set("Retry-After", ceilSeconds(result.RetryAfter))
+				writeProblem(res, req, apperrors.ErrRateLimited)
+				return
+			}
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// clientIP returns the address of the peer, or, if the peer is a trusted
+// proxy, the last address in X-Forwarded-For that is not a trusted proxy.
+// Addresses left of it may be forged by the client.
+func (rl RateLimits) clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !rl.trusted(peer) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			// a garbled entry was not added by a trusted proxy
+			return host
+		}
+		if !rl.trusted(addr) {
+			return addr.Unmap().String()
+		}
+		host = addr.Unmap().String()
+	}
+	return host
+}
+
+func (rl RateLimits) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range rl.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/evgfitil/gophermart.git/internal/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	rl := RateLimits{
+		Store:  ratelimit.NewMemoryStore(),
+		Routes: map[string]ratelimit.Limit{RateLimitWithdraw: {Requests: 1, Window: time.Minute}},
+	}
+	handler := jwtauth.Verifier(tokenAuth)(rl.limit(RateLimitWithdraw)(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	})))
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	aliceToken, err := generateToken("alice")
+	require.NoError(t, err)
+	bobToken, err := generateToken("bob")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{
+			name:       "first anonymous request",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "second anonymous request from the same IP",
+			wantStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:       "first request of a user",
+			token:      aliceToken,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "second request of the same user",
+			token:      aliceToken,
+			wantStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:       "another user from the same IP",
+			token:      bobToken,
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, ts.URL, nil)
+			require.NoError(t, err)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			require.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, "1", resp.Header.Get("RateLimit-Limit"))
+			assert.Equal(t, "0", resp.Header.Get("RateLimit-Remaining"))
+			assert.Equal(t, "1;w=60", resp.Header.Get("RateLimit-Policy"))
+			if tt.wantStatus == http.StatusTooManyRequests {
+				assert.Equal(t, "60", resp.Header.Get("Retry-After"))
+				assert.Equal(t, problemContentType, resp.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestRateLimitNotConfigured(t *testing.T) {
+	rl := RateLimits{Store: ratelimit.NewMemoryStore()}
+	ts := httptest.NewServer(rl.limit(RateLimitLogin)(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	})))
+	defer ts.Close()
+
+	for i := 0; i < 3; i++ {
+		resp, err := ts.Client().Post(ts.URL, "application/json", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("RateLimit-Limit"))
+	}
+}
+
+func TestRateLimitClientIP(t *testing.T) {
+	trustedProxies, err := ratelimit.ParseTrustedProxies("10.0.0.0/8, 192.168.1.10")
+	require.NoError(t, err)
+	rl := RateLimits{TrustedProxies: trustedProxies}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "203.0.113.7:51000",
+			want:       "203.0.113.7",
+		},
+		{
+			name:         "forwarded for header from an untrusted peer",
+			remoteAddr:   "203.0.113.7:51000",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "trusted proxy",
+			remoteAddr:   "10.1.2.3:51000",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "forged entries left of the client",
+			remoteAddr:   "10.1.2.3:51000",
+			forwardedFor: []string{"1.2.3.4, 198.51.100.1"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "chain of trusted proxies",
+			remoteAddr:   "192.168.1.10:51000",
+			forwardedFor: []string{"198.51.100.1", "10.4.4.4"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:       "trusted proxy without the header",
+			remoteAddr: "10.1.2.3:51000",
+			want:       "10.1.2.3",
+		},
+		{
+			name:         "garbled header",
+			remoteAddr:   "10.1.2.3:51000",
+			forwardedFor: []string{"unknown"},
+			want:         "10.1.2.3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			assert.Equal(t, tt.want, rl.clientIP(req))
+		})
+	}
+}
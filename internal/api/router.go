@@ -1,34 +1,93 @@
 package api
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/jwtauth"
-	"time"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
 )
 
 const (
 	requestTimeout = 1 * time.Second
 )
 
-func Router(os OrderStorage, us UserStorage, bs BalanceStorage) chi.Router {
+// Dependencies are the storages and services the routes of Router are
+// served by.
+type Dependencies struct {
+	Orders      OrderStorage
+	Users       UserStorage
+	Balances    BalanceStorage
+	Events      EventSubscriber
+	Webhooks    WebhookStorage
+	Idempotency IdempotencyStorage
+	Health      HealthChecker
+	Admin       AdminStorage
+	Jobs        JobScheduler
+	AdminToken  string
+	RateLimits  RateLimits
+	// Validator checks requests and responses against the OpenAPI
+	// document, if set
+	Validator func(http.Handler) http.Handler
+}
+
+func Router(d Dependencies) chi.Router {
+	validator, rl := d.Validator, d.RateLimits
 	r := chi.NewRouter()
-	r.Use(middleware.Compress(5))
+	r.Use(Tracing)
+	r.Use(RequestID)
 	r.Use(jwtauth.Verifier(tokenAuth))
+	r.Use(AccessLog)
+	r.Use(Metrics)
+	r.Use(middleware.Compress(5))
+	r.Use(Decompress(maxDecompressedBodySize))
+	// the validator runs last on every route, so that callers are
+	// authenticated, limited and their bodies bounded before it reads them
+	if validator == nil {
+		validator = func(next http.Handler) http.Handler { return next }
+	}
+	r.NotFound(func(res http.ResponseWriter, req *http.Request) {
+		writeProblem(res, req, apperrors.ErrNotFound)
+	})
+	r.MethodNotAllowed(func(res http.ResponseWriter, req *http.Request) {
+		writeProblem(res, req, apperrors.ErrMethodNotAllowed)
+	})
+	r.With(validator).Get("/healthz", HandleLiveness())
+	r.With(validator).Get("/readyz", HandleReadiness(d.Health))
+	r.With(validator).Get("/api/openapi.json", HandleOpenAPI())
 	r.Route("/api/user", func(r chi.Router) {
-		r.Post("/register", HandleUserRegistration(us))
-		r.Post("/login", HandleUserLogin(us))
+		r.With(rl.limit(RateLimitRegister), RequireContentType(jsonContentType), LimitBody(maxAuthBodySize), validator, IdempotentRegistration(d.Idempotency)).Post("/register", HandleUserRegistration(d.Users))
+		r.With(rl.limit(RateLimitLogin), RequireContentType(jsonContentType), LimitBody(maxAuthBodySize), validator).Post("/login", HandleUserLogin(d.Users))
+	})
+	r.With(Authenticator).Route("/api/user/balance", func(r chi.Router) {
+		r.With(rl.limit(RateLimitBalance), validator).Get("/", HandleGetUserBalance(d.Balances))
+		r.With(rl.limit(RateLimitWithdraw), RequireContentType(jsonContentType), LimitBody(maxWithdrawBodySize), validator, Idempotency(d.Idempotency)).Post("/withdraw", HandleWithdrawBalance(d.Balances))
+	})
+	r.With(Authenticator).Route("/api/user/orders", func(r chi.Router) {
+		r.With(rl.limit(RateLimitOrdersUpload), RequireContentType(textContentType), LimitBody(maxOrderBodySize), validator, Idempotency(d.Idempotency)).Post("/", HandleUploadOrder(d.Orders, d.Users))
+		r.With(rl.limit(RateLimitOrders), validator).Get("/", HandleGetUserOrders(d.Orders, d.Users))
+	})
+	r.With(Authenticator, rl.limit(RateLimitWithdrawals), validator).Route("/api/user/withdrawals", func(r chi.Router) {
+		r.Get("/", HandleGetWithdrawals(d.Balances))
 	})
-	r.With(jwtauth.Authenticator).Route("/api/user/balance", func(r chi.Router) {
-		r.Get("/", HandleGetUserBalance(bs))
-		r.Post("/withdraw", HandleWithdrawBalance(bs))
+	r.With(Authenticator, rl.limit(RateLimitWebhooks)).Route("/api/user/webhooks", func(r chi.Router) {
+		r.With(RequireContentType(jsonContentType), LimitBody(maxWebhookBodySize), validator).Post("/", HandleCreateWebhook(d.Webhooks))
+		r.With(validator).Get("/", HandleGetWebhooks(d.Webhooks))
+		r.With(validator).Delete("/{id}", HandleDeleteWebhook(d.Webhooks))
+		r.With(validator).Get("/{id}/deliveries", HandleGetWebhookDeliveries(d.Webhooks))
 	})
-	r.With(jwtauth.Authenticator).Route("/api/user/orders", func(r chi.Router) {
-		r.Post("/", HandleUploadOrder(os, us))
-		r.Get("/", HandleGetUserOrders(os, us))
+	r.With(Authenticator, rl.limit(RateLimitEvents), validator).Get("/api/user/events", HandleUserEvents(d.Events, d.Users))
+	r.With(RequireAdmin(d.AdminToken), validator).Route("/api/admin/orders", func(r chi.Router) {
+		r.Get("/dead-letter", HandleGetDeadLetterOrders(d.Admin))
+		r.Post("/{number}/requeue", HandleRequeueOrder(d.Admin))
 	})
-	r.With(jwtauth.Authenticator).Route("/api/user/withdrawals", func(r chi.Router) {
-		r.Get("/", HandleGetWithdrawals(bs))
+	r.With(RequireAdmin(d.AdminToken), validator).Route("/api/admin/jobs", func(r chi.Router) {
+		r.Get("/", HandleGetJobs(d.Jobs))
+		r.Post("/{name}/run", HandleTriggerJob(d.Jobs))
+		r.Get("/{name}/runs", HandleGetJobRuns(d.Jobs))
 	})
 	return r
 }
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/models"
+	"github.com/evgfitil/gophermart.git/internal/netguard"
+)
+
+const (
+	webhookSecretSize = 32
+)
+
+var webhookEventTypes = map[string]bool{
+	models.OutboxEventOrderProcessed:  true,
+	models.OutboxEventOrderInvalid:    true,
+	models.OutboxEventPointsWithdrawn: true,
+}
+
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type WebhookStorage interface {
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	DeleteWebhook(ctx context.Context, userID int, webhookID int) error
+	GetUserID(ctx context.Context, username string) (int, error)
+	GetWebhookDeliveries(ctx context.Context, userID int, webhookID int) ([]models.WebhookDelivery, error)
+	GetWebhooks(ctx context.Context, userID int) ([]models.Webhook, error)
+}
+
+// webhookResolver resolves webhook hosts, which must not point into the
+// internal network
+var webhookResolver netguard.Resolver = net.DefaultResolver
+
+func validateWebhookRequest(ctx context.Context, webhook webhookRequest) error {
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", apperrors.ErrInvalidRequest)
+	}
+	if err = netguard.CheckHost(ctx, webhookResolver, u.Hostname()); err != nil {
+		logger.FromContext(ctx).Infof("rejected webhook url: %v", err)
+		return fmt.Errorf("%w: url must resolve to a public address", apperrors.ErrInvalidRequest)
+	}
+	if len(webhook.Events) == 0 {
+		return fmt.Errorf("%w: at least one event type is required", apperrors.ErrInvalidRequest)
+	}
+	for _, event := range webhook.Events {
+		if !webhookEventTypes[event] {
+			return fmt.Errorf("%w: unknown event type %q", apperrors.ErrInvalidRequest, event)
+		}
+	}
+	return nil
+}
+
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, webhookSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+func HandleCreateWebhook(ws WebhookStorage) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		requestContext, cancel := context.WithTimeout(req.Context(), requestTimeout)
+		defer cancel()
+
+		username, err := usernameFromContext(requestContext)
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		var currentRequest webhookRequest
+		if err = decodeJSON(req, &currentRequest); err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+		if err = validateWebhookRequest(requestContext, currentRequest); err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		userID, err := ws.GetUserID(requestContext, username)
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			writeProblem(res, req, fmt.Errorf("error generating webhook secret: %w", err))
+			return
+		}
+
+		webhook := models.Webhook{
+			UserID: userID,
+			URL:    currentRequest.URL,
+			Events: currentRequest.Events,
+			Secret: secret,
+		}
+		if err = ws.CreateWebhook(requestContext, &webhook); err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(http.StatusCreated)
+		json.NewEncoder(res).Encode(webhook)
+	}
+}
+
+func HandleGetWebhooks(ws WebhookStorage) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		requestContext, cancel := context.WithTimeout(req.Context(), requestTimeout)
+		defer cancel()
+
+		username, err := usernameFromContext(requestContext)
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		userID, err := ws.GetUserID(requestContext, username)
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		webhooks, err := ws.GetWebhooks(requestContext, userID)
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		if len(webhooks) == 0 {
+			res.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(webhooks)
+	}
+}
+
+func HandleDeleteWebhook(ws WebhookStorage) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		requestContext, cancel := context.WithTimeout(req.Context(), requestTimeout)
+		defer cancel()
+
+		username, err := usernameFromContext(requestContext)
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		webhookID, err := strconv.Atoi(chi.URLParam(req, "id"))
+		if err != nil {
+			writeProblem(res, req, fmt.Errorf("%w: invalid webhook id", apperrors.ErrInvalidRequest))
+			return
+		}
+
+		userID, err := ws.GetUserID(requestContext, username)
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		if err = ws.DeleteWebhook(requestContext, userID, webhookID); err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func HandleGetWebhookDeliveries(ws WebhookStorage) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		requestContext, cancel := context.WithTimeout(req.Context(), requestTimeout)
+		defer cancel()
+
+		username, err := usernameFromContext(requestContext)
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		webhookID, err := strconv.Atoi(chi.URLParam(req, "id"))
+		if err != nil {
+			writeProblem(res, req, fmt.Errorf("%w: invalid webhook id", apperrors.ErrInvalidRequest))
+			return
+		}
+
+		userID, err := ws.GetUserID(requestContext, username)
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		deliveries, err := ws.GetWebhookDeliveries(requestContext, userID, webhookID)
+		if err != nil {
+			writeProblem(res, req, err)
+			return
+		}
+
+		if len(deliveries) == 0 {
+			res.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(deliveries)
+	}
+}
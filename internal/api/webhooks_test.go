@@ -0,0 +1,229 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+	"github.com/evgfitil/gophermart.git/internal/mocks"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+type staticResolver map[string][]netip.Addr
+
+func (r staticResolver) LookupNetIP(_ context.Context, _ string, host string) ([]netip.Addr, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+func TestHandleWebhooks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockWebhookStorage := mocks.NewMockWebhookStorage(ctrl)
+
+	defaultResolver := webhookResolver
+	defer func() { webhookResolver = defaultResolver }()
+	webhookResolver = staticResolver{
+		"partner.example": {netip.MustParseAddr("93.184.216.34")},
+		"localhost":       {netip.MustParseAddr("127.0.0.1")},
+		"rebind.example":  {netip.MustParseAddr("93.184.216.34"), netip.MustParseAddr("192.168.0.10")},
+	}
+
+	tokenAuth = jwtauth.New("HS256", []byte("jwtDefaultSecret"), nil)
+	_, tokenString, _ := tokenAuth.Encode(map[string]interface{}{"user_id": "test_user", "exp": time.Now().Add(5 * time.Second).Unix()})
+
+	r := chi.NewRouter()
+	r.Use(jwtauth.Verifier(tokenAuth), Authenticator)
+	r.Post("/api/user/webhooks", HandleCreateWebhook(mockWebhookStorage))
+	r.Get("/api/user/webhooks", HandleGetWebhooks(mockWebhookStorage))
+	r.Delete("/api/user/webhooks/{id}", HandleDeleteWebhook(mockWebhookStorage))
+	r.Get("/api/user/webhooks/{id}/deliveries", HandleGetWebhookDeliveries(mockWebhookStorage))
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	tests := []struct {
+		name          string
+		requestMethod string
+		path          string
+		requestBody   string
+		mockSetup     func()
+		wantStatus    int
+	}{
+		{
+			name:          "create webhook",
+			requestMethod: http.MethodPost,
+			path:          "/api/user/webhooks",
+			requestBody:   `{"url":"https://partner.example/hook","events":["OrderProcessed","PointsWithdrawn"]}`,
+			mockSetup: func() {
+				mockWebhookStorage.EXPECT().GetUserID(gomock.Any(), "test_user").Return(1, nil)
+				mockWebhookStorage.EXPECT().CreateWebhook(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ any, webhook *models.Webhook) error {
+						assert.Equal(t, 1, webhook.UserID)
+						assert.Len(t, webhook.Secret, 2*webhookSecretSize)
+						webhook.ID = 7
+						return nil
+					})
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:          "invalid url",
+			requestMethod: http.MethodPost,
+			path:          "/api/user/webhooks",
+			requestBody:   `{"url":"ftp://partner.example/hook","events":["OrderProcessed"]}`,
+			mockSetup:     func() {},
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:          "loopback url",
+			requestMethod: http.MethodPost,
+			path:          "/api/user/webhooks",
+			requestBody:   `{"url":"http://localhost:8080/api/admin/jobs","events":["OrderProcessed"]}`,
+			mockSetup:     func() {},
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:          "cloud metadata url",
+			requestMethod: http.MethodPost,
+			path:          "/api/user/webhooks",
+			requestBody:   `{"url":"http://169.254.169.254/latest/meta-data/","events":["OrderProcessed"]}`,
+			mockSetup:     func() {},
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:          "host resolving to a private address",
+			requestMethod: http.MethodPost,
+			path:          "/api/user/webhooks",
+			requestBody:   `{"url":"https://rebind.example/hook","events":["OrderProcessed"]}`,
+			mockSetup:     func() {},
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:          "unresolvable host",
+			requestMethod: http.MethodPost,
+			path:          "/api/user/webhooks",
+			requestBody:   `{"url":"https://missing.example/hook","events":["OrderProcessed"]}`,
+			mockSetup:     func() {},
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:          "unknown event type",
+			requestMethod: http.MethodPost,
+			path:          "/api/user/webhooks",
+			requestBody:   `{"url":"https://partner.example/hook","events":["OrderEaten"]}`,
+			mockSetup:     func() {},
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:          "no webhooks",
+			requestMethod: http.MethodGet,
+			path:          "/api/user/webhooks",
+			mockSetup: func() {
+				mockWebhookStorage.EXPECT().GetUserID(gomock.Any(), "test_user").Return(1, nil)
+				mockWebhookStorage.EXPECT().GetWebhooks(gomock.Any(), 1).Return(nil, nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:          "delete webhook",
+			requestMethod: http.MethodDelete,
+			path:          "/api/user/webhooks/7",
+			mockSetup: func() {
+				mockWebhookStorage.EXPECT().GetUserID(gomock.Any(), "test_user").Return(1, nil)
+				mockWebhookStorage.EXPECT().DeleteWebhook(gomock.Any(), 1, 7).Return(nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:          "delete unknown webhook",
+			requestMethod: http.MethodDelete,
+			path:          "/api/user/webhooks/8",
+			mockSetup: func() {
+				mockWebhookStorage.EXPECT().GetUserID(gomock.Any(), "test_user").Return(1, nil)
+				mockWebhookStorage.EXPECT().DeleteWebhook(gomock.Any(), 1, 8).Return(apperrors.ErrWebhookNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:          "webhook deliveries",
+			requestMethod: http.MethodGet,
+			path:          "/api/user/webhooks/7/deliveries",
+			mockSetup: func() {
+				mockWebhookStorage.EXPECT().GetUserID(gomock.Any(), "test_user").Return(1, nil)
+				mockWebhookStorage.EXPECT().GetWebhookDeliveries(gomock.Any(), 1, 7).Return([]models.WebhookDelivery{
+					{ID: 3, WebhookID: 7, Status: models.WebhookDeliveryPending, Attempts: 1, CreatedAt: time.Now()},
+				}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "no webhook deliveries",
+			requestMethod: http.MethodGet,
+			path:          "/api/user/webhooks/7/deliveries",
+			mockSetup: func() {
+				mockWebhookStorage.EXPECT().GetUserID(gomock.Any(), "test_user").Return(1, nil)
+				mockWebhookStorage.EXPECT().GetWebhookDeliveries(gomock.Any(), 1, 7).Return(nil, nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:          "deliveries of another user's webhook",
+			requestMethod: http.MethodGet,
+			path:          "/api/user/webhooks/9/deliveries",
+			mockSetup: func() {
+				mockWebhookStorage.EXPECT().GetUserID(gomock.Any(), "test_user").Return(1, nil)
+				mockWebhookStorage.EXPECT().GetWebhookDeliveries(gomock.Any(), 1, 9).Return(nil, apperrors.ErrWebhookNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:          "deliveries of an invalid webhook id",
+			requestMethod: http.MethodGet,
+			path:          "/api/user/webhooks/seven/deliveries",
+			mockSetup:     func() {},
+			wantStatus:    http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			req, err := http.NewRequest(tt.requestMethod, ts.URL+tt.path, bytes.NewBufferString(tt.requestBody))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+tokenString)
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+
+			if tt.wantStatus == http.StatusCreated {
+				var webhook models.Webhook
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&webhook))
+				assert.Equal(t, 7, webhook.ID)
+				assert.NotEmpty(t, webhook.Secret)
+			}
+		})
+	}
+}
@@ -3,7 +3,22 @@ package apperrors
 import "errors"
 
 var (
-	ErrOrderAlreadyExists = errors.New("order already exists")
-	ErrOrderNumberTaken   = errors.New("order number already taken by another user")
-	ErrInsufficientFunds  = errors.New("insufficient funds")
+	ErrOrderAlreadyExists       = errors.New("order already exists")
+	ErrOrderNumberTaken         = errors.New("order number already taken by another user")
+	ErrInsufficientFunds        = errors.New("insufficient funds")
+	ErrWebhookNotFound          = errors.New("webhook not found")
+	ErrOrderNotFound            = errors.New("order not found")
+	ErrJobNotFound              = errors.New("job not found")
+	ErrInvalidRequest           = errors.New("invalid request")
+	ErrInvalidOrderNumber       = errors.New("invalid order number")
+	ErrUnauthorized             = errors.New("unauthorized")
+	ErrInvalidCredentials       = errors.New("wrong username or password")
+	ErrUserAlreadyExists        = errors.New("user already exists")
+	ErrIdempotencyKeyReused     = errors.New("idempotency key was already used for a different request")
+	ErrIdempotencyKeyInProgress = errors.New("request with this idempotency key is still being processed")
+	ErrNotFound                 = errors.New("not found")
+	ErrMethodNotAllowed         = errors.New("method not allowed")
+	ErrRateLimited              = errors.New("too many requests")
+	ErrUnsupportedMediaType     = errors.New("unsupported media type")
+	ErrRequestTooLarge          = errors.New("request body too large")
 )
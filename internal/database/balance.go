@@ -11,24 +11,24 @@ import (
 	"github.com/evgfitil/gophermart.git/internal/models"
 )
 
-func (db *DBStorage) GetUserBalance(ctx context.Context, userID int) (*models.Balance, error) {
-	var userBalance models.Balance
-
-	query := `
+const userBalanceQuery = `
         SELECT
-            COALESCE(SUM(CASE when type = 'accrual' THEN amount ELSE 0 END), 0) -
+            COALESCE(SUM(CASE when type IN ('accrual', 'correction') THEN amount ELSE 0 END), 0) -
             COALESCE(SUM(CASE when type = 'withdrawal' THEN amount ELSE 0 END), 0) AS current,
             COALESCE(SUM(CASE when type = 'withdrawal' THEN amount ELSE 0 END), 0) AS withdrawn
         FROM transactions
         WHERE user_id = $1
     `
 
-	err := db.conn.QueryRowContext(ctx, query, userID).Scan(&userBalance.Current, &userBalance.Withdrawn)
+func (db *DBStorage) GetUserBalance(ctx context.Context, userID int) (*models.Balance, error) {
+	var userBalance models.Balance
+
+	err := db.conn.QueryRowContext(ctx, userBalanceQuery, userID).Scan(&userBalance.Current, &userBalance.Withdrawn)
 	if err != nil {
 		if !errors.Is(err, sql.ErrNoRows) {
 			return &models.Balance{Current: 0, Withdrawn: 0}, nil
 		}
-		logger.Sugar.Errorf("error retrieving user balance: %v", err)
+		logger.FromContext(ctx).Errorf("error retrieving user balance: %v", err)
 		return &models.Balance{}, err
 	}
 
@@ -41,7 +41,7 @@ func (db *DBStorage) GetWithdrawals(ctx context.Context, userID int) ([]models.W
 	rows, err := db.conn.QueryContext(ctx, query, userID)
 	if err != nil {
 		if !errors.Is(err, sql.ErrNoRows) {
-			logger.Sugar.Errorf("error retrieving withdrawals: %v", err)
+			logger.FromContext(ctx).Errorf("error retrieving withdrawals: %v", err)
 			return nil, err
 		}
 	}
@@ -51,12 +51,12 @@ func (db *DBStorage) GetWithdrawals(ctx context.Context, userID int) ([]models.W
 		var withdrawal models.Withdrawal
 		err = rows.Scan(&withdrawal.OrderNumber, &withdrawal.Amount, &withdrawal.CreatedAt)
 		if err != nil {
-			logger.Sugar.Errorf("error retrieving withdrawals: %v", err)
+			logger.FromContext(ctx).Errorf("error retrieving withdrawals: %v", err)
 		}
 		withdrawals = append(withdrawals, withdrawal)
 	}
 	if err = rows.Err(); err != nil {
-		logger.Sugar.Errorf("error after row iteration: %v", err)
+		logger.FromContext(ctx).Errorf("error after row iteration: %v", err)
 		return nil, err
 	}
 
@@ -66,7 +66,7 @@ func (db *DBStorage) GetWithdrawals(ctx context.Context, userID int) ([]models.W
 func (db *DBStorage) WithdrawUserBalance(ctx context.Context, transaction *models.Transaction) error {
 	tx, err := db.conn.BeginTx(ctx, nil)
 	if err != nil {
-		logger.Sugar.Errorf("error starting transaction: %v", err)
+		logger.FromContext(ctx).Errorf("error starting transaction: %v", err)
 		return err
 	}
 	defer tx.Rollback()
@@ -74,14 +74,14 @@ func (db *DBStorage) WithdrawUserBalance(ctx context.Context, transaction *model
 	var currentBalance float64
 	balanceQuery := `
 	SELECT
-	    COALESCE(SUM(CASE WHEN type = 'accrual' THEN amount ELSE 0 END), 0) -
+	    COALESCE(SUM(CASE WHEN type IN ('accrual', 'correction') THEN amount ELSE 0 END), 0) -
 	    COALESCE(SUM(CASE WHEN type = 'withdrawal' THEN amount ELSE 0 END), 0) AS current
 	FROM transactions
 	WHERE user_id = $1;
     `
 	err = tx.QueryRowContext(ctx, balanceQuery, transaction.UserID).Scan(&currentBalance)
 	if err != nil {
-		logger.Sugar.Errorf("error retrieving user balance: %v", err)
+		logger.FromContext(ctx).Errorf("error retrieving user balance: %v", err)
 		return err
 	}
 
@@ -93,7 +93,7 @@ func (db *DBStorage) WithdrawUserBalance(ctx context.Context, transaction *model
 	orderQuery := `SELECT EXISTS(SELECT 1 FROM orders WHERE order_number = $1)`
 	err = tx.QueryRowContext(ctx, orderQuery, transaction.OrderNumber).Scan(&orderExists)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		logger.Sugar.Errorf("error querying order for user balance: %v", err)
+		logger.FromContext(ctx).Errorf("error querying order for user balance: %v", err)
 		return err
 	}
 
@@ -104,19 +104,31 @@ func (db *DBStorage) WithdrawUserBalance(ctx context.Context, transaction *model
 	createOrderQuery := `INSERT INTO orders (user_id, order_number, status, uploaded_at) VALUES ($1, $2, $3, $4)`
 	_, err = tx.ExecContext(ctx, createOrderQuery, transaction.UserID, transaction.OrderNumber, "PROCESSED", time.Now())
 	if err != nil {
-		logger.Sugar.Errorf("error inserting order for user withdraw: %v", err)
+		logger.FromContext(ctx).Errorf("error inserting order for user withdraw: %v", err)
 		return err
 	}
 
+	processedAt := time.Now()
 	createTransactionQuery := `INSERT INTO transactions (user_id, type, amount, order_number, created_at) VALUES ($1, $2, $3, $4, $5)`
-	_, err = tx.ExecContext(ctx, createTransactionQuery, transaction.UserID, transaction.Type, transaction.Amount, transaction.OrderNumber, time.Now())
+	_, err = tx.ExecContext(ctx, createTransactionQuery, transaction.UserID, transaction.Type, transaction.Amount, transaction.OrderNumber, processedAt)
 	if err != nil {
-		logger.Sugar.Errorf("error inserting transaction for withdraw: %v", err)
+		logger.FromContext(ctx).Errorf("error inserting transaction for withdraw: %v", err)
+		return err
+	}
+
+	if err = notifyBalanceEvent(ctx, tx, transaction.UserID); err != nil {
+		logger.FromContext(ctx).Errorf("error notifying balance change: %v", err)
+		return err
+	}
+
+	eventData := models.Withdrawal{OrderNumber: transaction.OrderNumber, Amount: transaction.Amount, CreatedAt: processedAt}
+	if err = insertOutboxEvent(ctx, tx, models.OutboxEventPointsWithdrawn, transaction.UserID, eventData); err != nil {
+		logger.FromContext(ctx).Errorf("error adding outbox event: %v", err)
 		return err
 	}
 
 	if err = tx.Commit(); err != nil {
-		logger.Sugar.Errorf("error committing transaction: %v", err)
+		logger.FromContext(ctx).Errorf("error committing transaction: %v", err)
 		return err
 	}
 
@@ -5,10 +5,12 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/XSAM/otelsql"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 
 	"github.com/evgfitil/gophermart.git/internal/logger"
 )
@@ -19,12 +21,19 @@ const (
 )
 
 type DBStorage struct {
-	conn *sql.DB
+	conn  *sql.DB
+	dsn   string
+	locks *leaderLocks
 }
 
 func NewDBStorage(databaseDSN string) (*DBStorage, error) {
 	var db DBStorage
-	conn, err := sql.Open(driverName, databaseDSN)
+	// every query, statement and transaction gets a span under the caller's
+	// span; without a configured tracer provider these are no-ops
+	conn, err := otelsql.Open(driverName, databaseDSN,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitConnResetSession: true, OmitRows: true}),
+	)
 
 	if err != nil {
 		logger.Sugar.Fatalf("unable to connect to database: %v", err)
@@ -47,10 +56,11 @@ func NewDBStorage(databaseDSN string) (*DBStorage, error) {
 		logger.Sugar.Infoln("migrations applied")
 	}
 
-	db = DBStorage{conn: conn}
+	db = DBStorage{conn: conn, dsn: databaseDSN, locks: newLeaderLocks()}
 	return &db, nil
 }
 
 func (db *DBStorage) Close() error {
+	db.locks.closeAll()
 	return db.conn.Close()
 }
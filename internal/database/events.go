@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+const (
+	userEventsChannel = "user_events"
+	newOrdersChannel  = "new_orders"
+)
+
+// userEventPayload is the NOTIFY payload. It carries the user ID that
+// models.Event hides from API clients.
+type userEventPayload struct {
+	models.Event
+	UserID int `json:"user_id"`
+}
+
+// notifyUserEvent queues a notification inside tx. Postgres delivers it to
+// listeners only when tx commits, so rolled back changes are never announced.
+func notifyUserEvent(ctx context.Context, tx *sql.Tx, event models.Event) error {
+	payload, err := json.Marshal(userEventPayload{Event: event, UserID: event.UserID})
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, userEventsChannel, string(payload))
+	return err
+}
+
+func notifyBalanceEvent(ctx context.Context, tx *sql.Tx, userID int) error {
+	var balance models.Balance
+	if err := tx.QueryRowContext(ctx, userBalanceQuery, userID).Scan(&balance.Current, &balance.Withdrawn); err != nil {
+		return err
+	}
+	return notifyUserEvent(ctx, tx, models.Event{
+		Type:    models.EventTypeBalance,
+		UserID:  userID,
+		Balance: &balance,
+	})
+}
+
+// notifyNewOrder announces an uploaded order to the loyalty processors once
+// tx commits.
+func notifyNewOrder(ctx context.Context, tx *sql.Tx, orderNumber string) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, newOrdersChannel, orderNumber)
+	return err
+}
+
+// listen opens a dedicated connection, subscribes to channel and calls handle
+// with the payload of every notification. It blocks until ctx is cancelled
+// or the connection fails.
+func (db *DBStorage) listen(ctx context.Context, channel string, handle func(payload string)) error {
+	conn, err := pgx.Connect(ctx, db.dsn)
+	if err != nil {
+		return fmt.Errorf("error connecting listener: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err = conn.Exec(ctx, "LISTEN "+channel); err != nil {
+		return fmt.Errorf("error subscribing to %s: %w", channel, err)
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		handle(notification.Payload)
+	}
+}
+
+// ListenUserEvents calls handle for every user event until ctx is cancelled
+// or the connection fails.
+func (db *DBStorage) ListenUserEvents(ctx context.Context, handle func(models.Event)) error {
+	return db.listen(ctx, userEventsChannel, func(data string) {
+		var payload userEventPayload
+		if err := json.Unmarshal([]byte(data), &payload); err != nil {
+			logger.FromContext(ctx).Errorf("error decoding user event: %v", err)
+			return
+		}
+		payload.Event.UserID = payload.UserID
+		handle(payload.Event)
+	})
+}
+
+// ListenNewOrders calls handle with the number of every uploaded order until
+// ctx is cancelled or the connection fails.
+func (db *DBStorage) ListenNewOrders(ctx context.Context, handle func(orderNumber string)) error {
+	return db.listen(ctx, newOrdersChannel, handle)
+}
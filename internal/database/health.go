@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func (db *DBStorage) Ping(ctx context.Context) error {
+	return db.conn.PingContext(ctx)
+}
+
+// latestMigrationVersion returns the highest version found in migrationPath.
+func latestMigrationVersion() (uint64, error) {
+	files, err := filepath.Glob(filepath.Join(migrationPath, "*.up.sql"))
+	if err != nil {
+		return 0, err
+	}
+
+	var latest uint64
+	for _, file := range files {
+		prefix, _, found := strings.Cut(filepath.Base(file), "_")
+		if !found {
+			continue
+		}
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest, nil
+}
+
+// CheckMigrations reports the applied schema version and fails if the schema
+// is dirty or behind the migrations shipped with the binary.
+func (db *DBStorage) CheckMigrations(ctx context.Context) (map[string]any, error) {
+	expected, err := latestMigrationVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	var version uint64
+	var dirty bool
+	err = db.conn.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		return map[string]any{"expected": expected}, err
+	}
+
+	details := map[string]any{"version": version, "expected": expected, "dirty": dirty}
+	if dirty {
+		return details, fmt.Errorf("migration %d is dirty", version)
+	}
+	if version < expected {
+		return details, fmt.Errorf("schema version %d is behind %d", version, expected)
+	}
+	return details, nil
+}
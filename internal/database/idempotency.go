@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+// ReserveIdempotencyKey atomically claims record.Key for the caller. If the
+// key is already taken and has not expired yet, the stored record is returned
+// with reserved set to false.
+func (db *DBStorage) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord, ttl time.Duration) (*models.IdempotencyRecord, bool, error) {
+	reserveQuery := `
+	INSERT INTO idempotency_keys (scope, key, request_hash) VALUES ($1, $2, $3)
+	ON CONFLICT (scope, key) DO UPDATE
+	SET request_hash = EXCLUDED.request_hash, status_code = NULL, response_headers = NULL, response_body = NULL, created_at = now()
+	WHERE idempotency_keys.created_at < now() - $4 * interval '1 second'
+	RETURNING created_at
+	`
+	err := db.conn.QueryRowContext(ctx, reserveQuery, record.Scope, record.Key, record.RequestHash, ttl.Seconds()).Scan(&record.CreatedAt)
+	if err == nil {
+		return record, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		logger.FromContext(ctx).Errorf("error reserving idempotency key: %v", err)
+		return nil, false, err
+	}
+
+	stored := models.IdempotencyRecord{Scope: record.Scope, Key: record.Key}
+	var statusCode sql.NullInt32
+	var header []byte
+	selectQuery := `SELECT request_hash, status_code, response_headers, response_body, created_at FROM idempotency_keys WHERE scope = $1 AND key = $2`
+	err = db.conn.QueryRowContext(ctx, selectQuery, record.Scope, record.Key).
+		Scan(&stored.RequestHash, &statusCode, &header, &stored.Body, &stored.CreatedAt)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error retrieving idempotency key: %v", err)
+		return nil, false, err
+	}
+	stored.StatusCode = int(statusCode.Int32)
+	if header != nil {
+		if err = json.Unmarshal(header, &stored.Header); err != nil {
+			logger.FromContext(ctx).Errorf("error decoding stored response headers: %v", err)
+			return nil, false, err
+		}
+	}
+	return &stored, false, nil
+}
+
+func (db *DBStorage) SaveIdempotencyResponse(ctx context.Context, record *models.IdempotencyRecord) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE idempotency_keys SET status_code = $3, response_headers = $4, response_body = $5 WHERE scope = $1 AND key = $2`
+	_, err = db.conn.ExecContext(ctx, query, record.Scope, record.Key, record.StatusCode, header, record.Body)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error saving idempotent response: %v", err)
+	}
+	return err
+}
+
+func (db *DBStorage) DeleteIdempotencyKey(ctx context.Context, scope string, key string) error {
+	_, err := db.conn.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2`, scope, key)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error deleting idempotency key: %v", err)
+	}
+	return err
+}
+
+// DeleteIdempotencyKeysBefore removes keys created before t, which can no
+// longer be replayed.
+func (db *DBStorage) DeleteIdempotencyKeysBefore(ctx context.Context, t time.Time) (int64, error) {
+	result, err := db.conn.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at < $1`, t)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error deleting idempotency keys: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
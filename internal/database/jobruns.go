@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+const jobRunColumns = `id, job, trigger, status, COALESCE(instance, ''), COALESCE(error, ''), created_at, started_at, finished_at`
+
+type jobRunScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJobRun(row jobRunScanner) (models.JobRun, error) {
+	var run models.JobRun
+	var startedAt, finishedAt sql.NullTime
+	err := row.Scan(&run.ID, &run.Job, &run.Trigger, &run.Status, &run.Instance, &run.Error, &run.CreatedAt, &startedAt, &finishedAt)
+	if startedAt.Valid {
+		run.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		run.FinishedAt = &finishedAt.Time
+	}
+	return run, err
+}
+
+// CreateJobRun records a new run and fills in its ID and times. Running
+// runs are started now, pending ones wait to be claimed.
+func (db *DBStorage) CreateJobRun(ctx context.Context, run *models.JobRun) error {
+	query := `INSERT INTO job_runs (job, trigger, status, instance, started_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), CASE WHEN $3 = 'running' THEN CURRENT_TIMESTAMP END)
+		RETURNING ` + jobRunColumns
+	created, err := scanJobRun(db.conn.QueryRowContext(ctx, query, run.Job, run.Trigger, run.Status, run.Instance))
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error creating job run: %v", err)
+		return err
+	}
+	*run = created
+	return nil
+}
+
+// ClaimPendingJobRun starts the oldest pending run of the job on instance.
+// It returns nil when no run is pending.
+func (db *DBStorage) ClaimPendingJobRun(ctx context.Context, job string, instance string) (*models.JobRun, error) {
+	query := `UPDATE job_runs SET status = 'running', instance = $2, started_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM job_runs WHERE job = $1 AND status = 'pending'
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + jobRunColumns
+	run, err := scanJobRun(db.conn.QueryRowContext(ctx, query, job, instance))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error claiming job run: %v", err)
+		return nil, err
+	}
+	return &run, nil
+}
+
+// FinishJobRun records the outcome of a run.
+func (db *DBStorage) FinishJobRun(ctx context.Context, id int64, status string, runErr string) error {
+	query := `UPDATE job_runs SET status = $1, error = NULLIF($2, ''), finished_at = CURRENT_TIMESTAMP WHERE id = $3`
+	if _, err := db.conn.ExecContext(ctx, query, status, runErr, id); err != nil {
+		logger.FromContext(ctx).Errorf("error finishing job run: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetJobRuns returns up to limit latest runs of the job, newest first.
+func (db *DBStorage) GetJobRuns(ctx context.Context, job string, limit int) ([]models.JobRun, error) {
+	query := `SELECT ` + jobRunColumns + ` FROM job_runs WHERE job = $1 ORDER BY id DESC LIMIT $2`
+	return db.queryJobRuns(ctx, query, job, limit)
+}
+
+// GetLatestJobRuns returns the latest run of every job that has run.
+func (db *DBStorage) GetLatestJobRuns(ctx context.Context) ([]models.JobRun, error) {
+	query := `SELECT DISTINCT ON (job) ` + jobRunColumns + ` FROM job_runs ORDER BY job, id DESC`
+	return db.queryJobRuns(ctx, query)
+}
+
+func (db *DBStorage) queryJobRuns(ctx context.Context, query string, args ...any) ([]models.JobRun, error) {
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error retrieving job runs: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]models.JobRun, 0)
+	for rows.Next() {
+		run, err := scanJobRun(rows)
+		if err != nil {
+			logger.FromContext(ctx).Errorf("error retrieving job run: %v", err)
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	if err = rows.Err(); err != nil {
+		logger.FromContext(ctx).Errorf("error after row iteration: %v", err)
+		return nil, err
+	}
+	return runs, nil
+}
+
+// DeleteJobRunsBefore removes finished runs created before t.
+func (db *DBStorage) DeleteJobRunsBefore(ctx context.Context, t time.Time) (int64, error) {
+	query := `DELETE FROM job_runs WHERE created_at < $1 AND status IN ('succeeded', 'failed')`
+	result, err := db.conn.ExecContext(ctx, query, t)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error deleting job runs: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
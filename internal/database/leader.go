@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+var errLeaderLockNotHeld = errors.New("leader lock is not held")
+
+// leaderLocks keeps the dedicated connections holding advisory locks.
+// Postgres releases a session lock when its connection goes away, which is
+// what lets another instance take over from a leader that died.
+type leaderLocks struct {
+	mu    sync.Mutex
+	conns map[string]*pgx.Conn
+}
+
+func newLeaderLocks() *leaderLocks {
+	return &leaderLocks{conns: make(map[string]*pgx.Conn)}
+}
+
+func (l *leaderLocks) closeAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for name, conn := range l.conns {
+		conn.Close(context.Background())
+		delete(l.conns, name)
+	}
+}
+
+// advisoryLockKey maps the election name to the key of its advisory lock.
+func advisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("gophermart:leader:" + name))
+	return int64(h.Sum64())
+}
+
+// upsertLeaseQuery records holder's lease unless another holder's lease has
+// not expired yet.
+const upsertLeaseQuery = `INSERT INTO leader_leases (name, holder, acquired_at, renewed_at, expires_at)
+	VALUES ($1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP + make_interval(secs => $3))
+	ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, acquired_at = EXCLUDED.acquired_at,
+		renewed_at = EXCLUDED.renewed_at, expires_at = EXCLUDED.expires_at
+	WHERE leader_leases.holder = EXCLUDED.holder OR leader_leases.expires_at <= CURRENT_TIMESTAMP`
+
+// TryLeaderLock tries to take the advisory lock of the election on a
+// dedicated connection and, if it succeeds, records holder's lease for ttl.
+// It reports false when another instance holds the lock or when the lease of
+// the previous leader has not expired. The lock is released as soon as the
+// connection of a leader drops, while that leader keeps running its jobs
+// until its next renewal fails, so the lease is what keeps them apart.
+func (db *DBStorage) TryLeaderLock(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	db.locks.mu.Lock()
+	defer db.locks.mu.Unlock()
+	if _, ok := db.locks.conns[name]; ok {
+		return true, nil
+	}
+
+	conn, err := pgx.Connect(ctx, db.dsn)
+	if err != nil {
+		return false, fmt.Errorf("error connecting leader lock: %w", err)
+	}
+
+	var locked bool
+	if err = conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, advisoryLockKey(name)).Scan(&locked); err != nil {
+		conn.Close(context.Background())
+		return false, fmt.Errorf("error taking leader lock: %w", err)
+	}
+	if !locked {
+		conn.Close(context.Background())
+		return false, nil
+	}
+
+	tag, err := conn.Exec(ctx, upsertLeaseQuery, name, holder, ttl.Seconds())
+	if err != nil || tag.RowsAffected() == 0 {
+		// closing the connection releases the lock
+		conn.Close(context.Background())
+		if err != nil {
+			return false, fmt.Errorf("error recording leader lease: %w", err)
+		}
+		return false, nil
+	}
+	db.locks.conns[name] = conn
+	return true, nil
+}
+
+// RenewLeaderLock extends holder's lease by ttl. The update runs on the
+// connection holding the lock, so it only succeeds while the lock is held.
+// After a failure the caller steps down with ReleaseLeaderLock.
+func (db *DBStorage) RenewLeaderLock(ctx context.Context, name string, holder string, ttl time.Duration) error {
+	db.locks.mu.Lock()
+	defer db.locks.mu.Unlock()
+	conn, ok := db.locks.conns[name]
+	if !ok {
+		return errLeaderLockNotHeld
+	}
+
+	query := `UPDATE leader_leases SET renewed_at = CURRENT_TIMESTAMP, expires_at = CURRENT_TIMESTAMP + make_interval(secs => $3)
+		WHERE name = $1 AND holder = $2`
+	tag, err := conn.Exec(ctx, query, name, holder, ttl.Seconds())
+	if err == nil && tag.RowsAffected() == 0 {
+		// the lease row was removed, the lock is still ours
+		tag, err = conn.Exec(ctx, upsertLeaseQuery, name, holder, ttl.Seconds())
+		if err == nil && tag.RowsAffected() == 0 {
+			err = errLeaderLockNotHeld
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error renewing leader lease: %w", err)
+	}
+	return nil
+}
+
+// ReleaseLeaderLock ends the lease and releases the advisory lock so that
+// another instance can take over without waiting for the lease to expire.
+func (db *DBStorage) ReleaseLeaderLock(ctx context.Context, name string) error {
+	db.locks.mu.Lock()
+	defer db.locks.mu.Unlock()
+	conn, ok := db.locks.conns[name]
+	if !ok {
+		return nil
+	}
+	delete(db.locks.conns, name)
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, `DELETE FROM leader_leases WHERE name = $1`, name); err != nil {
+		logger.FromContext(ctx).Errorf("error removing leader lease: %v", err)
+	}
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_unlock($1)`, advisoryLockKey(name)); err != nil {
+		return fmt.Errorf("error releasing leader lock: %w", err)
+	}
+	return nil
+}
+
+// GetLeaderLease returns the lease of the election or nil if nobody has
+// held it yet or the last leader stepped down.
+func (db *DBStorage) GetLeaderLease(ctx context.Context, name string) (*models.LeaderLease, error) {
+	lease := models.LeaderLease{Name: name}
+	query := `SELECT holder, acquired_at, renewed_at, expires_at FROM leader_leases WHERE name = $1`
+	err := db.conn.QueryRowContext(ctx, query, name).Scan(&lease.Holder, &lease.AcquiredAt, &lease.RenewedAt, &lease.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error retrieving leader lease: %v", err)
+		return nil, err
+	}
+	return &lease, nil
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+func (db *DBStorage) Stats() sql.DBStats {
+	return db.conn.Stats()
+}
+
+func (db *DBStorage) GetLedgerTotals(ctx context.Context) ([]models.LedgerTotal, error) {
+	var totals []models.LedgerTotal
+	rows, err := db.conn.QueryContext(ctx, `SELECT type, COUNT(*), COALESCE(SUM(amount), 0) FROM transactions GROUP BY type`)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error retrieving ledger totals: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var total models.LedgerTotal
+		if err = rows.Scan(&total.Type, &total.Count, &total.Amount); err != nil {
+			logger.FromContext(ctx).Errorf("error retrieving ledger total: %v", err)
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+	if err = rows.Err(); err != nil {
+		logger.FromContext(ctx).Errorf("error after row iteration: %v", err)
+		return nil, err
+	}
+	return totals, nil
+}
+
+func (db *DBStorage) CountOrdersByStatus(ctx context.Context) (map[string]int, error) {
+	counts := make(map[string]int)
+	query := `SELECT status, COUNT(*) FROM orders WHERE status NOT IN ('PROCESSED', 'INVALID') GROUP BY status`
+	rows, err := db.conn.QueryContext(ctx, query)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error counting orders: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status string
+		var count int
+		if err = rows.Scan(&status, &count); err != nil {
+			logger.FromContext(ctx).Errorf("error counting orders: %v", err)
+			return nil, err
+		}
+		counts[status] = count
+	}
+	if err = rows.Err(); err != nil {
+		logger.FromContext(ctx).Errorf("error after row iteration: %v", err)
+		return nil, err
+	}
+	return counts, nil
+}
@@ -31,7 +31,7 @@ func (db *DBStorage) GetOrders(ctx context.Context, userID int) ([]models.Order,
 	rows, err := db.conn.QueryContext(ctx, query, userID)
 	if err != nil {
 		if !errors.Is(err, sql.ErrNoRows) {
-			logger.Sugar.Errorf("error retrieving orders: %v", err)
+			logger.FromContext(ctx).Errorf("error retrieving orders: %v", err)
 		}
 	}
 	defer rows.Close()
@@ -40,40 +40,45 @@ func (db *DBStorage) GetOrders(ctx context.Context, userID int) ([]models.Order,
 		var order models.Order
 		err = rows.Scan(&order.OrderNumber, &order.Status, &order.Accrual, &order.UploadedAt)
 		if err != nil {
-			logger.Sugar.Errorf("error retrieving order: %v", err)
+			logger.FromContext(ctx).Errorf("error retrieving order: %v", err)
 		}
 		orders = append(orders, order)
 	}
 	if err = rows.Err(); err != nil {
-		logger.Sugar.Errorf("error after row iteration: %v", err)
+		logger.FromContext(ctx).Errorf("error after row iteration: %v", err)
 		return nil, err
 	}
 
 	return orders, nil
 }
 
-func (db *DBStorage) GetNewOrders(ctx context.Context) ([]models.Order, error) {
+// GetNewOrders returns up to limit unfinished orders and processed orders
+// marked for a recheck that are due, the longest waiting first.
+// Dead-lettered orders are skipped.
+func (db *DBStorage) GetNewOrders(ctx context.Context, limit int) ([]models.Order, error) {
 	var orders []models.Order
 
-	query := `SELECT id, order_number, user_id, status, uploaded_at FROM orders WHERE status NOT IN ('PROCESSED', 'INVALID')`
-	rows, err := db.conn.QueryContext(ctx, query)
+	query := `SELECT id, order_number, user_id, status, uploaded_at, attempts FROM orders
+		WHERE (status IN ('NEW', 'PROCESSING') OR recheck) AND dead_lettered_at IS NULL AND next_check_at <= CURRENT_TIMESTAMP
+		ORDER BY next_check_at LIMIT $1`
+	rows, err := db.conn.QueryContext(ctx, query, limit)
 	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			logger.Sugar.Errorf("error retrieving orders: %v", err)
-		}
+		logger.FromContext(ctx).Errorf("error retrieving orders: %v", err)
+		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var order models.Order
-		err = rows.Scan(&order.ID, &order.OrderNumber, &order.UserID, &order.Status, &order.UploadedAt)
+		err = rows.Scan(&order.ID, &order.OrderNumber, &order.UserID, &order.Status, &order.UploadedAt, &order.Attempts)
 		if err != nil {
-			logger.Sugar.Errorf("error retrieving order: %v", err)
+			logger.FromContext(ctx).Errorf("error retrieving order: %v", err)
+			return nil, err
 		}
 		orders = append(orders, order)
 	}
 	if err = rows.Err(); err != nil {
-		logger.Sugar.Errorf("error after row iteration: %v", err)
+		logger.FromContext(ctx).Errorf("error after row iteration: %v", err)
 		return nil, err
 	}
 	return orders, nil
@@ -105,6 +110,14 @@ func (db *DBStorage) ProcessOrder(ctx context.Context, order models.Order) error
 		return err
 	}
 
+	eventData := orderEventData{Order: order.OrderNumber, Status: order.Status}
+	if err = insertOutboxEvent(ctx, tx, models.OutboxEventOrderUploaded, order.UserID, eventData); err != nil {
+		return err
+	}
+	if err = notifyNewOrder(ctx, tx, order.OrderNumber); err != nil {
+		return err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return err
 	}
@@ -115,35 +128,56 @@ func (db *DBStorage) ProcessOrder(ctx context.Context, order models.Order) error
 func (db *DBStorage) UpdateOrderAccrual(ctx context.Context, orderNumber string, accrual float64) error {
 	tx, err := db.conn.BeginTx(ctx, nil)
 	if err != nil {
-		logger.Sugar.Errorf("error starting transaction: %v", err)
+		logger.FromContext(ctx).Errorf("error starting transaction: %v", err)
+		return err
 	}
 	defer tx.Rollback()
 
 	updateOrderQuery := `UPDATE orders SET accrual = $1, status = 'PROCESSED' WHERE order_number = $2`
 	_, err = tx.ExecContext(ctx, updateOrderQuery, accrual, orderNumber)
 	if err != nil {
-		logger.Sugar.Errorf("error updating order: %v", err)
+		logger.FromContext(ctx).Errorf("error updating order: %v", err)
 		return err
 	}
 
 	var userID int
-	var orderID string
-	getUserAndOrderIDQuery := `SELECT user_id, id FROM orders WHERE order_number = $1`
-	row := tx.QueryRowContext(ctx, getUserAndOrderIDQuery, orderNumber)
-	if err = row.Scan(&userID, &orderID); err != nil {
-		logger.Sugar.Errorf("error getting user_id for order: %v", err)
+	getUserIDQuery := `SELECT user_id FROM orders WHERE order_number = $1`
+	if err = tx.QueryRowContext(ctx, getUserIDQuery, orderNumber).Scan(&userID); err != nil {
+		logger.FromContext(ctx).Errorf("error getting user_id for order: %v", err)
 		return err
 	}
 
 	addTransactionQuery := `INSERT INTO transactions (user_id, type, amount, order_number) VALUES ($1, $2, $3, $4)`
-	_, err = tx.ExecContext(ctx, addTransactionQuery, userID, "accrual", accrual, orderID)
+	_, err = tx.ExecContext(ctx, addTransactionQuery, userID, models.TransactionTypeAccrual, accrual, orderNumber)
 	if err != nil {
-		logger.Sugar.Errorf("error adding transaction: %v", err)
+		logger.FromContext(ctx).Errorf("error adding transaction: %v", err)
+		return err
+	}
+
+	err = notifyUserEvent(ctx, tx, models.Event{
+		Type:    models.EventTypeOrderStatus,
+		UserID:  userID,
+		Order:   orderNumber,
+		Status:  "PROCESSED",
+		Accrual: accrual,
+	})
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error notifying order status change: %v", err)
+		return err
+	}
+	if err = notifyBalanceEvent(ctx, tx, userID); err != nil {
+		logger.FromContext(ctx).Errorf("error notifying balance change: %v", err)
+		return err
+	}
+
+	eventData := orderEventData{Order: orderNumber, Status: "PROCESSED", Accrual: accrual}
+	if err = insertOutboxEvent(ctx, tx, models.OutboxEventOrderProcessed, userID, eventData); err != nil {
+		logger.FromContext(ctx).Errorf("error adding outbox event: %v", err)
 		return err
 	}
 
 	if err = tx.Commit(); err != nil {
-		logger.Sugar.Errorf("error committing transaction: %v", err)
+		logger.FromContext(ctx).Errorf("error committing transaction: %v", err)
 		return err
 	}
 	return nil
@@ -152,19 +186,43 @@ func (db *DBStorage) UpdateOrderAccrual(ctx context.Context, orderNumber string,
 func (db *DBStorage) UpdateOrderStatus(ctx context.Context, orderNumber string, status string) error {
 	tx, err := db.conn.BeginTx(ctx, nil)
 	if err != nil {
-		logger.Sugar.Errorf("error starting transaction: %v", err)
+		logger.FromContext(ctx).Errorf("error starting transaction: %v", err)
+		return err
 	}
 	defer tx.Rollback()
 
-	updateOrderStatusQuery := `UPDATE orders SET status = $1 WHERE order_number = $2`
-	_, err = tx.ExecContext(ctx, updateOrderStatusQuery, status, orderNumber)
+	var userID int
+	updateOrderStatusQuery := `UPDATE orders SET status = $1 WHERE order_number = $2 AND status <> $1 RETURNING user_id`
+	err = tx.QueryRowContext(ctx, updateOrderStatusQuery, status, orderNumber).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error updating order: %v", err)
+		return err
+	}
+
+	err = notifyUserEvent(ctx, tx, models.Event{
+		Type:   models.EventTypeOrderStatus,
+		UserID: userID,
+		Order:  orderNumber,
+		Status: status,
+	})
 	if err != nil {
-		logger.Sugar.Errorf("error updating order: %v", err)
+		logger.FromContext(ctx).Errorf("error notifying order status change: %v", err)
 		return err
 	}
 
+	if status == "INVALID" {
+		eventData := orderEventData{Order: orderNumber, Status: status}
+		if err = insertOutboxEvent(ctx, tx, models.OutboxEventOrderInvalid, userID, eventData); err != nil {
+			logger.FromContext(ctx).Errorf("error adding outbox event: %v", err)
+			return err
+		}
+	}
+
 	if err = tx.Commit(); err != nil {
-		logger.Sugar.Errorf("error committing transaction: %v", err)
+		logger.FromContext(ctx).Errorf("error committing transaction: %v", err)
 		return err
 	}
 
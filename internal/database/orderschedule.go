@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+// RescheduleOrder records a failed check of the order and postpones the next
+// one until nextCheckAt.
+func (db *DBStorage) RescheduleOrder(ctx context.Context, orderNumber string, nextCheckAt time.Time, lastError string) error {
+	query := `UPDATE orders SET attempts = attempts + 1, next_check_at = $1, last_error = $2 WHERE order_number = $3`
+	if _, err := db.conn.ExecContext(ctx, query, nextCheckAt, lastError, orderNumber); err != nil {
+		logger.FromContext(ctx).Errorf("error rescheduling order: %v", err)
+		return err
+	}
+	return nil
+}
+
+// DeferOrder postpones the next check of the order without counting a failed
+// attempt, for failures of the accrual system rather than of the order.
+func (db *DBStorage) DeferOrder(ctx context.Context, orderNumber string, nextCheckAt time.Time, lastError string) error {
+	query := `UPDATE orders SET next_check_at = $1, last_error = $2 WHERE order_number = $3`
+	if _, err := db.conn.ExecContext(ctx, query, nextCheckAt, lastError, orderNumber); err != nil {
+		logger.FromContext(ctx).Errorf("error deferring order: %v", err)
+		return err
+	}
+	return nil
+}
+
+// DeadLetterOrder records a failed check of the order and stops checking it
+// until it is requeued.
+func (db *DBStorage) DeadLetterOrder(ctx context.Context, orderNumber string, lastError string) error {
+	query := `UPDATE orders SET attempts = attempts + 1, last_error = $1, dead_lettered_at = CURRENT_TIMESTAMP WHERE order_number = $2`
+	if _, err := db.conn.ExecContext(ctx, query, lastError, orderNumber); err != nil {
+		logger.FromContext(ctx).Errorf("error dead-lettering order: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (db *DBStorage) GetDeadLetterOrders(ctx context.Context, limit int) ([]models.DeadLetterOrder, error) {
+	query := `SELECT order_number, user_id, status, attempts, COALESCE(last_error, ''), uploaded_at, dead_lettered_at
+		FROM orders WHERE dead_lettered_at IS NOT NULL ORDER BY dead_lettered_at LIMIT $1`
+	rows, err := db.conn.QueryContext(ctx, query, limit)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error retrieving dead-lettered orders: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]models.DeadLetterOrder, 0)
+	for rows.Next() {
+		var order models.DeadLetterOrder
+		err = rows.Scan(&order.OrderNumber, &order.UserID, &order.Status, &order.Attempts, &order.LastError,
+			&order.UploadedAt, &order.DeadLetteredAt)
+		if err != nil {
+			logger.FromContext(ctx).Errorf("error retrieving dead-lettered order: %v", err)
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	if err = rows.Err(); err != nil {
+		logger.FromContext(ctx).Errorf("error after row iteration: %v", err)
+		return nil, err
+	}
+	return orders, nil
+}
+
+// RequeueOrder moves a dead-lettered order back to processing with fresh
+// attempts.
+func (db *DBStorage) RequeueOrder(ctx context.Context, orderNumber string) error {
+	query := `UPDATE orders SET attempts = 0, next_check_at = CURRENT_TIMESTAMP, last_error = NULL, dead_lettered_at = NULL
+		WHERE order_number = $1 AND dead_lettered_at IS NOT NULL`
+	result, err := db.conn.ExecContext(ctx, query, orderNumber)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error requeueing order: %v", err)
+		return err
+	}
+	requeued, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if requeued == 0 {
+		return apperrors.ErrOrderNotFound
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+type userEventData struct {
+	Login string `json:"login"`
+}
+
+type orderEventData struct {
+	Order   string  `json:"order"`
+	Status  string  `json:"status"`
+	Accrual float64 `json:"accrual,omitempty"`
+}
+
+// insertOutboxEvent records a domain event inside tx, so it is persisted if
+// and only if the change that produced it is committed.
+func insertOutboxEvent(ctx context.Context, tx *sql.Tx, eventType string, userID int, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO outbox (event_type, user_id, payload) VALUES ($1, $2, $3)`
+	_, err = tx.ExecContext(ctx, query, eventType, userID, payload)
+	return err
+}
+
+// outboxClaimLock serialises the claims of outbox relays.
+const outboxClaimLock = "outbox_relay"
+
+// ClaimOutboxEvents claims up to limit unpublished events for lease and
+// returns them in outbox order. Nothing is claimed while another relay holds
+// an unexpired claim, so events are published in order by one relay at a
+// time, as long as a relay finishes its batch within the lease. The events
+// are not locked while they are published.
+func (db *DBStorage) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error starting transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, advisoryLockKey(outboxClaimLock)); err != nil {
+		logger.FromContext(ctx).Errorf("error locking outbox claims: %v", err)
+		return nil, err
+	}
+
+	var events []models.OutboxEvent
+	query := `
+	UPDATE outbox
+	SET publish_claimed_until = now() + $2 * interval '1 second'
+	WHERE id IN (
+	      SELECT id FROM outbox
+	      WHERE published_at IS NULL
+	      ORDER BY id
+	      LIMIT $1
+	  )
+	  AND NOT EXISTS (
+	      SELECT 1 FROM outbox
+	      WHERE published_at IS NULL AND publish_claimed_until > now()
+	  )
+	RETURNING id, event_type, user_id, payload, created_at
+	`
+	rows, err := tx.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error claiming outbox events: %v", err)
+		return nil, err
+	}
+	for rows.Next() {
+		var event models.OutboxEvent
+		if err = rows.Scan(&event.ID, &event.Type, &event.UserID, &event.Payload, &event.CreatedAt); err != nil {
+			rows.Close()
+			logger.FromContext(ctx).Errorf("error retrieving outbox event: %v", err)
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		logger.FromContext(ctx).Errorf("error after row iteration: %v", err)
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.FromContext(ctx).Errorf("error committing transaction: %v", err)
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+// MarkOutboxEventsPublished marks claimed events as published.
+func (db *DBStorage) MarkOutboxEventsPublished(ctx context.Context, ids []int64) error {
+	query := `UPDATE outbox SET published_at = now(), publish_claimed_until = NULL WHERE id = ANY($1)`
+	if _, err := db.conn.ExecContext(ctx, query, ids); err != nil {
+		logger.FromContext(ctx).Errorf("error marking outbox events as published: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ReleaseOutboxEvents gives up the claim on events that were not published,
+// so that the next claim picks them up without waiting for the lease.
+func (db *DBStorage) ReleaseOutboxEvents(ctx context.Context, ids []int64) error {
+	query := `UPDATE outbox SET publish_claimed_until = NULL WHERE id = ANY($1) AND published_at IS NULL`
+	if _, err := db.conn.ExecContext(ctx, query, ids); err != nil {
+		logger.FromContext(ctx).Errorf("error releasing outbox events: %v", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteOutboxEventsBefore removes events created before t that every
+// consumer is done with: they were fanned out to webhooks, none of their
+// deliveries is still pending and, if published is set, they were published
+// to the event bus. The finished deliveries of those events go with them.
+func (db *DBStorage) DeleteOutboxEventsBefore(ctx context.Context, t time.Time, published bool) (int64, error) {
+	query := `
+	WITH events AS (
+	    SELECT id FROM outbox o
+	    WHERE created_at < $1
+	      AND dispatched_at IS NOT NULL
+	      AND (published_at IS NOT NULL OR NOT $2)
+	      AND NOT EXISTS (
+	          SELECT 1 FROM webhook_deliveries d
+	          WHERE d.outbox_id = o.id AND d.status = $3
+	      )
+	    FOR UPDATE SKIP LOCKED
+	), deliveries AS (
+	    DELETE FROM webhook_deliveries WHERE outbox_id IN (SELECT id FROM events)
+	)
+	DELETE FROM outbox WHERE id IN (SELECT id FROM events)
+	`
+	result, err := db.conn.ExecContext(ctx, query, t, published, models.WebhookDeliveryPending)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error deleting outbox events: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
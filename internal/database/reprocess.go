@@ -0,0 +1,232 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+// ReprocessOrders makes the orders matching filter due for a check again.
+// Invalid orders start over as NEW, processed orders are marked for a
+// recheck, and with correct a changed accrual of a processed order is
+// corrected in the ledger once the recheck answers. With dryRun nothing is
+// changed. Orders created by withdrawals are never selected, the accrual
+// system does not know them.
+func (db *DBStorage) ReprocessOrders(ctx context.Context, filter models.OrderFilter, correct bool, dryRun bool) ([]models.ReprocessedOrder, error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error starting transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	where, args := orderFilterConditions(filter)
+	query := `SELECT o.id, o.order_number, u.username, o.status, COALESCE(o.accrual, 0)
+		FROM orders o JOIN users u ON u.id = o.user_id
+		WHERE NOT EXISTS (SELECT 1 FROM transactions t WHERE t.order_number = o.order_number AND t.type = 'withdrawal')` +
+		where + `
+		ORDER BY o.uploaded_at
+		FOR UPDATE OF o`
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error selecting orders for reprocessing: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]models.ReprocessedOrder, 0)
+	var ids []int
+	for rows.Next() {
+		var id int
+		var order models.ReprocessedOrder
+		if err = rows.Scan(&id, &order.OrderNumber, &order.Username, &order.Status, &order.Accrual); err != nil {
+			logger.FromContext(ctx).Errorf("error retrieving order for reprocessing: %v", err)
+			return nil, err
+		}
+		switch {
+		case order.Status != models.OrderStatusProcessed:
+			order.Action = models.ReprocessActionRequeue
+		case correct:
+			order.Action = models.ReprocessActionCorrect
+		default:
+			order.Action = models.ReprocessActionRecheck
+		}
+		ids = append(ids, id)
+		orders = append(orders, order)
+	}
+	if err = rows.Err(); err != nil {
+		logger.FromContext(ctx).Errorf("error after row iteration: %v", err)
+		return nil, err
+	}
+	rows.Close()
+
+	if dryRun {
+		return orders, nil
+	}
+
+	// the right-hand sides see the status before the update
+	updateQuery := `UPDATE orders SET
+		status = CASE WHEN status = 'INVALID' THEN 'NEW' ELSE status END,
+		recheck = (status = 'PROCESSED'),
+		recheck_correct = (status = 'PROCESSED' AND $1),
+		attempts = 0, next_check_at = CURRENT_TIMESTAMP, last_error = NULL, dead_lettered_at = NULL
+		WHERE id = $2`
+	for _, id := range ids {
+		if _, err = tx.ExecContext(ctx, updateQuery, correct, id); err != nil {
+			logger.FromContext(ctx).Errorf("error resetting order for reprocessing: %v", err)
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.FromContext(ctx).Errorf("error committing transaction: %v", err)
+		return nil, err
+	}
+	return orders, nil
+}
+
+// orderFilterConditions returns the AND conditions on orders o and users u
+// for filter with their arguments.
+func orderFilterConditions(filter models.OrderFilter) (string, []any) {
+	var conditions strings.Builder
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	in := func(column string, values []string) {
+		placeholders := make([]string, len(values))
+		for i, value := range values {
+			placeholders[i] = arg(value)
+		}
+		fmt.Fprintf(&conditions, " AND %s IN (%s)", column, strings.Join(placeholders, ", "))
+	}
+
+	if len(filter.Statuses) > 0 {
+		in("o.status", filter.Statuses)
+	}
+	if len(filter.Numbers) > 0 {
+		in("o.order_number", filter.Numbers)
+	}
+	if filter.Username != "" {
+		fmt.Fprintf(&conditions, " AND u.username = %s", arg(filter.Username))
+	}
+	if !filter.From.IsZero() {
+		fmt.Fprintf(&conditions, " AND o.uploaded_at >= %s", arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		fmt.Fprintf(&conditions, " AND o.uploaded_at < %s", arg(filter.To))
+	}
+	return conditions.String(), args
+}
+
+// RecheckOrderAccrual applies the accrual of a processed order marked for a
+// recheck. A changed accrual is corrected in the ledger if the recheck was
+// requested with corrections and recorded as the last error otherwise. A
+// correction that would take the balance below zero is refused and recorded
+// as the last error too.
+func (db *DBStorage) RecheckOrderAccrual(ctx context.Context, orderNumber string, accrual float64) (*models.AccrualRecheck, error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error starting transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	var correct bool
+	recheck := models.AccrualRecheck{Accrual: accrual}
+	query := `SELECT user_id, COALESCE(accrual, 0), recheck_correct FROM orders WHERE order_number = $1 AND recheck FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, orderNumber).Scan(&userID, &recheck.Previous, &correct)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperrors.ErrOrderNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error retrieving order for recheck: %v", err)
+		return nil, err
+	}
+
+	// accruals are stored in cents
+	difference := math.Round((accrual-recheck.Previous)*100) / 100
+	recheck.Changed = difference != 0
+	var lastError sql.NullString
+	switch {
+	case !recheck.Changed:
+	case correct:
+		var balance, withdrawn float64
+		if err = tx.QueryRowContext(ctx, userBalanceQuery, userID).Scan(&balance, &withdrawn); err != nil {
+			logger.FromContext(ctx).Errorf("error retrieving user balance: %v", err)
+			return nil, err
+		}
+		if difference < 0 && math.Round((balance+difference)*100) < 0 {
+			recheck.Refused = true
+			lastError = sql.NullString{
+				String: fmt.Sprintf("accrual changed from %.2f to %.2f, not corrected: the balance of %.2f cannot cover it",
+					recheck.Previous, accrual, balance),
+				Valid: true,
+			}
+			break
+		}
+		if err = db.correctOrderAccrual(ctx, tx, userID, orderNumber, accrual, difference); err != nil {
+			return nil, err
+		}
+		recheck.Corrected = true
+	default:
+		lastError = sql.NullString{
+			String: fmt.Sprintf("accrual changed from %.2f to %.2f, not corrected", recheck.Previous, accrual),
+			Valid:  true,
+		}
+	}
+
+	finishQuery := `UPDATE orders SET recheck = FALSE, recheck_correct = FALSE, attempts = 0, last_error = $1
+		WHERE order_number = $2`
+	if _, err = tx.ExecContext(ctx, finishQuery, lastError, orderNumber); err != nil {
+		logger.FromContext(ctx).Errorf("error finishing order recheck: %v", err)
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.FromContext(ctx).Errorf("error committing transaction: %v", err)
+		return nil, err
+	}
+	return &recheck, nil
+}
+
+func (db *DBStorage) correctOrderAccrual(ctx context.Context, tx *sql.Tx, userID int, orderNumber string, accrual float64, difference float64) error {
+	updateOrderQuery := `UPDATE orders SET accrual = $1 WHERE order_number = $2`
+	if _, err := tx.ExecContext(ctx, updateOrderQuery, accrual, orderNumber); err != nil {
+		logger.FromContext(ctx).Errorf("error updating order accrual: %v", err)
+		return err
+	}
+
+	addTransactionQuery := `INSERT INTO transactions (user_id, type, amount, order_number) VALUES ($1, $2, $3, $4)`
+	_, err := tx.ExecContext(ctx, addTransactionQuery, userID, models.TransactionTypeCorrection, difference, orderNumber)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error adding correction transaction: %v", err)
+		return err
+	}
+
+	err = notifyUserEvent(ctx, tx, models.Event{
+		Type:    models.EventTypeOrderStatus,
+		UserID:  userID,
+		Order:   orderNumber,
+		Status:  models.OrderStatusProcessed,
+		Accrual: accrual,
+	})
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error notifying order status change: %v", err)
+		return err
+	}
+	if err = notifyBalanceEvent(ctx, tx, userID); err != nil {
+		logger.FromContext(ctx).Errorf("error notifying balance change: %v", err)
+		return err
+	}
+	return nil
+}
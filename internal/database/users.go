@@ -7,9 +7,24 @@ import (
 )
 
 func (db *DBStorage) CreateUser(ctx context.Context, username string, passwordHash string) error {
-	_, err := db.conn.ExecContext(ctx,
-		`INSERT INTO users (username, password_hash) VALUES ($1, $2)`, username, passwordHash)
-	return err
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO users (username, password_hash) VALUES ($1, $2) RETURNING id`, username, passwordHash).Scan(&userID)
+	if err != nil {
+		return err
+	}
+
+	if err = insertOutboxEvent(ctx, tx, models.OutboxEventUserRegistered, userID, userEventData{Login: username}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (db *DBStorage) GetUserID(ctx context.Context, username string) (int, error) {
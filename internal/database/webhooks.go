@@ -0,0 +1,231 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+const (
+	webhookDeliveryLogLimit = 100
+)
+
+func (db *DBStorage) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	query := `INSERT INTO webhook_subscriptions (user_id, url, secret, event_types) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	err := db.conn.QueryRowContext(ctx, query, webhook.UserID, webhook.URL, webhook.Secret, webhook.Events).
+		Scan(&webhook.ID, &webhook.CreatedAt)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error creating webhook: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (db *DBStorage) GetWebhooks(ctx context.Context, userID int) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	typeMap := pgtype.NewMap()
+
+	query := `SELECT id, url, event_types, created_at FROM webhook_subscriptions WHERE user_id = $1 ORDER BY id`
+	rows, err := db.conn.QueryContext(ctx, query, userID)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error retrieving webhooks: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		webhook := models.Webhook{UserID: userID}
+		err = rows.Scan(&webhook.ID, &webhook.URL, typeMap.SQLScanner(&webhook.Events), &webhook.CreatedAt)
+		if err != nil {
+			logger.FromContext(ctx).Errorf("error retrieving webhook: %v", err)
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err = rows.Err(); err != nil {
+		logger.FromContext(ctx).Errorf("error after row iteration: %v", err)
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (db *DBStorage) DeleteWebhook(ctx context.Context, userID int, webhookID int) error {
+	query := `DELETE FROM webhook_subscriptions WHERE id = $1 AND user_id = $2`
+	result, err := db.conn.ExecContext(ctx, query, webhookID, userID)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error deleting webhook: %v", err)
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return apperrors.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (db *DBStorage) GetWebhookDeliveries(ctx context.Context, userID int, webhookID int) ([]models.WebhookDelivery, error) {
+	var exists bool
+	existsQuery := `SELECT EXISTS(SELECT 1 FROM webhook_subscriptions WHERE id = $1 AND user_id = $2)`
+	if err := db.conn.QueryRowContext(ctx, existsQuery, webhookID, userID).Scan(&exists); err != nil {
+		logger.FromContext(ctx).Errorf("error querying webhook: %v", err)
+		return nil, err
+	}
+	if !exists {
+		return nil, apperrors.ErrWebhookNotFound
+	}
+
+	var deliveries []models.WebhookDelivery
+	query := `
+	SELECT d.id, d.subscription_id, d.status, d.attempts, d.response_status, d.last_error, d.created_at, d.delivered_at,
+	       o.id, o.event_type, o.payload, o.created_at
+	FROM webhook_deliveries d
+	JOIN outbox o ON o.id = d.outbox_id
+	WHERE d.subscription_id = $1
+	ORDER BY d.id DESC
+	LIMIT $2
+	`
+	rows, err := db.conn.QueryContext(ctx, query, webhookID, webhookDeliveryLogLimit)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error retrieving webhook deliveries: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Status, &delivery.Attempts, &delivery.ResponseStatus,
+			&delivery.LastError, &delivery.CreatedAt, &delivery.DeliveredAt,
+			&delivery.Event.ID, &delivery.Event.Type, &delivery.Event.Payload, &delivery.Event.CreatedAt)
+		if err != nil {
+			logger.FromContext(ctx).Errorf("error retrieving webhook delivery: %v", err)
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		logger.FromContext(ctx).Errorf("error after row iteration: %v", err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// FanOutOutboxEvents creates a pending delivery for every subscription that
+// matches a not yet dispatched outbox event and marks those events as
+// dispatched. Everything happens in a single statement, so an event is either
+// fanned out completely or not at all.
+func (db *DBStorage) FanOutOutboxEvents(ctx context.Context, limit int) (int, error) {
+	query := `
+	WITH events AS (
+	    SELECT id, event_type, user_id
+	    FROM outbox
+	    WHERE dispatched_at IS NULL
+	    ORDER BY id
+	    LIMIT $1
+	    FOR UPDATE SKIP LOCKED
+	), deliveries AS (
+	    INSERT INTO webhook_deliveries (subscription_id, outbox_id)
+	    SELECT s.id, e.id
+	    FROM events e
+	    JOIN webhook_subscriptions s ON s.user_id = e.user_id AND e.event_type = ANY(s.event_types)
+	    ON CONFLICT (subscription_id, outbox_id) DO NOTHING
+	)
+	UPDATE outbox SET dispatched_at = now() WHERE id IN (SELECT id FROM events)
+	`
+	result, err := db.conn.ExecContext(ctx, query, limit)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error fanning out outbox events: %v", err)
+		return 0, err
+	}
+	dispatched, err := result.RowsAffected()
+	return int(dispatched), err
+}
+
+// ClaimWebhookDeliveries returns pending deliveries that are due and pushes
+// their next attempt forward by lease, so concurrent dispatchers do not pick
+// up the same delivery.
+func (db *DBStorage) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+
+	query := `
+	UPDATE webhook_deliveries d
+	SET next_attempt_at = now() + $2 * interval '1 second'
+	FROM webhook_subscriptions s, outbox o
+	WHERE d.subscription_id = s.id
+	  AND d.outbox_id = o.id
+	  AND d.id IN (
+	      SELECT id FROM webhook_deliveries
+	      WHERE status = 'PENDING' AND next_attempt_at <= now()
+	      ORDER BY next_attempt_at
+	      LIMIT $1
+	      FOR UPDATE SKIP LOCKED
+	  )
+	RETURNING d.id, d.subscription_id, d.attempts, d.created_at, s.url, s.secret,
+	          o.id, o.event_type, o.payload, o.created_at
+	`
+	rows, err := db.conn.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error claiming webhook deliveries: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		delivery := models.WebhookDelivery{Status: models.WebhookDeliveryPending}
+		err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Attempts, &delivery.CreatedAt, &delivery.URL, &delivery.Secret,
+			&delivery.Event.ID, &delivery.Event.Type, &delivery.Event.Payload, &delivery.Event.CreatedAt)
+		if err != nil {
+			logger.FromContext(ctx).Errorf("error retrieving webhook delivery: %v", err)
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		logger.FromContext(ctx).Errorf("error after row iteration: %v", err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RecordWebhookAttempt stores the outcome of a delivery attempt. nextAttemptAt
+// only matters while the delivery stays pending.
+func (db *DBStorage) RecordWebhookAttempt(ctx context.Context, deliveryID int64, status string, responseStatus int, lastError string, nextAttemptAt time.Time) error {
+	var respStatus sql.NullInt32
+	if responseStatus != 0 {
+		respStatus = sql.NullInt32{Int32: int32(responseStatus), Valid: true}
+	}
+	var errMsg sql.NullString
+	if lastError != "" {
+		errMsg = sql.NullString{String: lastError, Valid: true}
+	}
+	var deliveredAt sql.NullTime
+	if status == models.WebhookDeliveryDelivered {
+		deliveredAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+	if nextAttemptAt.IsZero() {
+		nextAttemptAt = time.Now()
+	}
+
+	query := `
+	UPDATE webhook_deliveries
+	SET status = $2, attempts = attempts + 1, response_status = $3, last_error = $4, delivered_at = $5, next_attempt_at = $6
+	WHERE id = $1
+	`
+	_, err := db.conn.ExecContext(ctx, query, deliveryID, status, respStatus, errMsg, deliveredAt, nextAttemptAt)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.FromContext(ctx).Errorf("error recording webhook attempt: %v", err)
+	}
+	return err
+}
@@ -0,0 +1,128 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+
+	defaultCheckTimeout = 2 * time.Second
+)
+
+// Check reports the state of a single component. Details are included in the
+// report as is, a non-nil error marks the component as down.
+type Check func(ctx context.Context) (map[string]any, error)
+
+type ComponentReport struct {
+	Status string `json:"status"`
+	// Informational components are reported but do not affect readiness
+	Informational bool           `json:"informational,omitempty"`
+	Error         string         `json:"error,omitempty"`
+	Details       map[string]any `json:"details,omitempty"`
+}
+
+type Report struct {
+	Status       string                     `json:"status"`
+	ShuttingDown bool                       `json:"shutting_down,omitempty"`
+	Components   map[string]ComponentReport `json:"components"`
+}
+
+type registeredCheck struct {
+	check         Check
+	informational bool
+}
+
+// Service aggregates the readiness checks of all components.
+type Service struct {
+	mu           sync.RWMutex
+	checks       map[string]registeredCheck
+	timeout      time.Duration
+	shuttingDown atomic.Bool
+}
+
+func NewService() *Service {
+	return &Service{
+		checks:  make(map[string]registeredCheck),
+		timeout: defaultCheckTimeout,
+	}
+}
+
+// Register adds a check the instance needs to pass to be ready.
+func (s *Service) Register(name string, check Check) {
+	s.register(name, registeredCheck{check: check})
+}
+
+// RegisterInformational adds a check that is only reported. A failing
+// informational check does not take the instance out of rotation, which
+// suits dependencies shared by all instances, such as the accrual system.
+func (s *Service) RegisterInformational(name string, check Check) {
+	s.register(name, registeredCheck{check: check, informational: true})
+}
+
+func (s *Service) register(name string, check registeredCheck) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks[name] = check
+}
+
+// SetShuttingDown makes every following readiness check fail, so that the
+// instance is taken out of rotation before it stops serving.
+func (s *Service) SetShuttingDown() {
+	s.shuttingDown.Store(true)
+}
+
+// Check runs all registered checks concurrently and reports whether the
+// instance is ready to serve traffic.
+func (s *Service) Check(ctx context.Context) (Report, bool) {
+	s.mu.RLock()
+	checks := make(map[string]registeredCheck, len(s.checks))
+	for name, check := range s.checks {
+		checks[name] = check
+	}
+	s.mu.RUnlock()
+
+	report := Report{
+		Status:       StatusUp,
+		ShuttingDown: s.shuttingDown.Load(),
+		Components:   make(map[string]ComponentReport, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check registeredCheck) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, s.timeout)
+			defer cancel()
+
+			component := ComponentReport{Status: StatusUp, Informational: check.informational}
+			details, err := check.check(checkCtx)
+			component.Details = details
+			if err != nil {
+				component.Status = StatusDown
+				component.Error = err.Error()
+			}
+
+			mu.Lock()
+			report.Components[name] = component
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	for _, component := range report.Components {
+		if component.Status != StatusUp && !component.Informational {
+			report.Status = StatusDown
+		}
+	}
+	if report.ShuttingDown {
+		report.Status = StatusDown
+	}
+	return report, report.Status == StatusUp
+}
@@ -0,0 +1,77 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceCheck(t *testing.T) {
+	up := func(ctx context.Context) (map[string]any, error) {
+		return map[string]any{"version": 7}, nil
+	}
+	down := func(ctx context.Context) (map[string]any, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	tests := []struct {
+		name          string
+		checks        map[string]Check
+		informational map[string]Check
+		shuttingDown  bool
+		wantReady     bool
+		wantStatus    map[string]string
+	}{
+		{
+			name:       "all components up",
+			checks:     map[string]Check{"database": up, "migrations": up},
+			wantReady:  true,
+			wantStatus: map[string]string{"database": StatusUp, "migrations": StatusUp},
+		},
+		{
+			name:       "component down",
+			checks:     map[string]Check{"database": up, "accrual": down},
+			wantReady:  false,
+			wantStatus: map[string]string{"database": StatusUp, "accrual": StatusDown},
+		},
+		{
+			name:          "informational component down",
+			checks:        map[string]Check{"database": up},
+			informational: map[string]Check{"accrual": down},
+			wantReady:     true,
+			wantStatus:    map[string]string{"database": StatusUp, "accrual": StatusDown},
+		},
+		{
+			name:         "shutting down",
+			checks:       map[string]Check{"database": up},
+			shuttingDown: true,
+			wantReady:    false,
+			wantStatus:   map[string]string{"database": StatusUp},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewService()
+			for name, check := range tt.checks {
+				s.Register(name, check)
+			}
+			for name, check := range tt.informational {
+				s.RegisterInformational(name, check)
+			}
+			if tt.shuttingDown {
+				s.SetShuttingDown()
+			}
+
+			report, ready := s.Check(context.Background())
+
+			assert.Equal(t, tt.wantReady, ready)
+			assert.Equal(t, tt.shuttingDown, report.ShuttingDown)
+			for name, status := range tt.wantStatus {
+				assert.Equal(t, status, report.Components[name].Status)
+			}
+		})
+	}
+}
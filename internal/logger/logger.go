@@ -1,17 +1,37 @@
 package logger
 
 import (
+	"context"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"os"
+	"strings"
 )
 
-var Sugar *zap.SugaredLogger
+// Sugar discards everything until InitLogger is called.
+var Sugar = zap.NewNop().Sugar()
+
+type contextKey struct{}
+
+// WithContext returns a copy of ctx carrying l, so that code further down
+// the call chain logs with the same correlation fields.
+func WithContext(ctx context.Context, l *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger stored by WithContext or Sugar if there is
+// none.
+func FromContext(ctx context.Context) *zap.SugaredLogger {
+	if l, ok := ctx.Value(contextKey{}).(*zap.SugaredLogger); ok {
+		return l
+	}
+	return Sugar
+}
 
 func InitLogger(logLevelEnv string) {
 	var logLevel zapcore.Level
 
-	switch logLevelEnv {
+	switch strings.ToUpper(logLevelEnv) {
 	case "DEBUG":
 		logLevel = zap.DebugLevel
 	case "INFO":
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+type DBStatsProvider interface {
+	Stats() sql.DBStats
+}
+
+type LedgerStorage interface {
+	GetLedgerTotals(ctx context.Context) ([]models.LedgerTotal, error)
+}
+
+// DBStatsCollector exports the sql.DB connection pool statistics.
+type DBStatsCollector struct {
+	provider          DBStatsProvider
+	maxOpen           *prometheus.Desc
+	open              *prometheus.Desc
+	inUse             *prometheus.Desc
+	idle              *prometheus.Desc
+	waitCount         *prometheus.Desc
+	waitDuration      *prometheus.Desc
+	maxIdleClosed     *prometheus.Desc
+	maxLifetimeClosed *prometheus.Desc
+}
+
+func NewDBStatsCollector(p DBStatsProvider) *DBStatsCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", name), help, nil, nil)
+	}
+	return &DBStatsCollector{
+		provider:          p,
+		maxOpen:           desc("max_open_connections", "Maximum number of open connections to the database."),
+		open:              desc("open_connections", "The number of established connections both in use and idle."),
+		inUse:             desc("in_use_connections", "The number of connections currently in use."),
+		idle:              desc("idle_connections", "The number of idle connections."),
+		waitCount:         desc("wait_count_total", "The total number of connections waited for."),
+		waitDuration:      desc("wait_duration_seconds_total", "The total time blocked waiting for a new connection."),
+		maxIdleClosed:     desc("max_idle_closed_total", "The total number of connections closed due to SetMaxIdleConns."),
+		maxLifetimeClosed: desc("max_lifetime_closed_total", "The total number of connections closed due to SetConnMaxLifetime."),
+	}
+}
+
+func (c *DBStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *DBStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.provider.Stats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(stats.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(c.maxLifetimeClosed, prometheus.CounterValue, float64(stats.MaxLifetimeClosed))
+}
+
+// RefreshLedger sets the ledger gauges to the number and the sum of ledger
+// transactions by type. The totals take a scan of the whole ledger, so they
+// are refreshed by a background job rather than on scrape.
+func RefreshLedger(ctx context.Context, ls LedgerStorage) error {
+	totals, err := ls.GetLedgerTotals(ctx)
+	if err != nil {
+		return fmt.Errorf("error collecting ledger metrics: %w", err)
+	}
+	for _, total := range totals {
+		LedgerTransactions.WithLabelValues(total.Type).Set(float64(total.Count))
+		LedgerAmount.WithLabelValues(total.Type).Set(total.Amount)
+	}
+	return nil
+}
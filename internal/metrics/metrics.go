@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	namespace = "gophermart"
+)
+
+var (
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method and route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	AccrualRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "requests_total",
+		Help:      "Requests to the accrual system by response status code, \"error\" for transport errors.",
+	}, []string{"status"})
+
+	AccrualRetryAfterSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "retry_after_seconds",
+		Help:      "Time spent waiting before retrying the accrual system.",
+		Buckets:   []float64{0.5, 1, 2, 5, 10, 30, 60, 120},
+	})
+
+	AccrualAnomaliesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "anomalies_total",
+		Help:      "Accrual system responses rejected by validation, by reason.",
+	}, []string{"reason"})
+
+	OrderBacklog = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "orders",
+		Name:      "backlog",
+		Help:      "Orders waiting for the accrual system by status.",
+	}, []string{"status"})
+
+	LedgerTransactions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "ledger",
+		Name:      "transactions",
+		Help:      "Number of ledger transactions by type.",
+	}, []string{"type"})
+
+	LedgerAmount = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "ledger",
+		Name:      "amount",
+		Help:      "Sum of ledger transactions by type.",
+	}, []string{"type"})
+
+	ProcessorRunDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "processor",
+		Name:      "run_duration_seconds",
+		Help:      "Duration of a loyalty processor polling run.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60},
+	})
+
+	ProcessorAccrualsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "processor",
+		Name:      "accruals_total",
+		Help:      "Accruals credited by the loyalty processor of this instance.",
+	})
+
+	ProcessorDeadLettersTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "processor",
+		Name:      "dead_letters_total",
+		Help:      "Orders moved to the dead letter by the loyalty processor of this instance.",
+	})
+
+	JobRunsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "scheduler",
+		Name:      "job_runs_total",
+		Help:      "Background job runs on this instance by job and status: succeeded or failed.",
+	}, []string{"job", "status"})
+
+	JobRunDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "scheduler",
+		Name:      "job_run_duration_seconds",
+		Help:      "Duration of background job runs by job.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300},
+	}, []string{"job"})
+
+	LeaderTransitionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "leader",
+		Name:      "transitions_total",
+		Help:      "Leadership changes of this instance by direction: acquired or released.",
+	}, []string{"direction"})
+
+	ProcessorAccrualCorrectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "processor",
+		Name:      "accrual_corrections_total",
+		Help:      "Changed accruals of rechecked processed orders by result: corrected, skipped or refused.",
+	}, []string{"result"})
+
+	ProcessorAccruedPointsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "processor",
+		Name:      "accrued_points_total",
+		Help:      "Points credited by the loyalty processor of this instance.",
+	})
+)
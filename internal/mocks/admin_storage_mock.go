@@ -0,0 +1,70 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: internal/api/admin.go
+//
+// Generated by this command:
+//
+//	mockgen -source=internal/api/admin.go -destination=internal/mocks/admin_storage_mock.go -package=mocks
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	models "github.com/evgfitil/gophermart.git/internal/models"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockAdminStorage is a mock of AdminStorage interface.
+type MockAdminStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockAdminStorageMockRecorder
+}
+
+// MockAdminStorageMockRecorder is the mock recorder for MockAdminStorage.
+type MockAdminStorageMockRecorder struct {
+	mock *MockAdminStorage
+}
+
+// NewMockAdminStorage creates a new mock instance.
+func NewMockAdminStorage(ctrl *gomock.Controller) *MockAdminStorage {
+	mock := &MockAdminStorage{ctrl: ctrl}
+	mock.recorder = &MockAdminStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAdminStorage) EXPECT() *MockAdminStorageMockRecorder {
+	return m.recorder
+}
+
+// GetDeadLetterOrders mocks base method.
+func (m *MockAdminStorage) GetDeadLetterOrders(ctx context.Context, limit int) ([]models.DeadLetterOrder, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeadLetterOrders", ctx, limit)
+	ret0, _ := ret[0].([]models.DeadLetterOrder)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeadLetterOrders indicates an expected call of GetDeadLetterOrders.
+func (mr *MockAdminStorageMockRecorder) GetDeadLetterOrders(ctx, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeadLetterOrders", reflect.TypeOf((*MockAdminStorage)(nil).GetDeadLetterOrders), ctx, limit)
+}
+
+// RequeueOrder mocks base method.
+func (m *MockAdminStorage) RequeueOrder(ctx context.Context, orderNumber string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequeueOrder", ctx, orderNumber)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RequeueOrder indicates an expected call of RequeueOrder.
+func (mr *MockAdminStorageMockRecorder) RequeueOrder(ctx, orderNumber any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequeueOrder", reflect.TypeOf((*MockAdminStorage)(nil).RequeueOrder), ctx, orderNumber)
+}
@@ -0,0 +1,55 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: internal/api/events.go
+//
+// Generated by this command:
+//
+//	mockgen -source=internal/api/events.go -destination=internal/mocks/event_subscriber_mock.go -package=mocks
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	reflect "reflect"
+
+	models "github.com/evgfitil/gophermart.git/internal/models"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockEventSubscriber is a mock of EventSubscriber interface.
+type MockEventSubscriber struct {
+	ctrl     *gomock.Controller
+	recorder *MockEventSubscriberMockRecorder
+}
+
+// MockEventSubscriberMockRecorder is the mock recorder for MockEventSubscriber.
+type MockEventSubscriberMockRecorder struct {
+	mock *MockEventSubscriber
+}
+
+// NewMockEventSubscriber creates a new mock instance.
+func NewMockEventSubscriber(ctrl *gomock.Controller) *MockEventSubscriber {
+	mock := &MockEventSubscriber{ctrl: ctrl}
+	mock.recorder = &MockEventSubscriberMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockEventSubscriber) EXPECT() *MockEventSubscriberMockRecorder {
+	return m.recorder
+}
+
+// Subscribe mocks base method.
+func (m *MockEventSubscriber) Subscribe(userID int) (<-chan models.Event, func()) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Subscribe", userID)
+	ret0, _ := ret[0].(<-chan models.Event)
+	ret1, _ := ret[1].(func())
+	return ret0, ret1
+}
+
+// Subscribe indicates an expected call of Subscribe.
+func (mr *MockEventSubscriberMockRecorder) Subscribe(userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockEventSubscriber)(nil).Subscribe), userID)
+}
@@ -0,0 +1,86 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: internal/api/idempotency.go
+//
+// Generated by this command:
+//
+//	mockgen -source=internal/api/idempotency.go -destination=internal/mocks/idempotency_storage_mock.go -package=mocks
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	models "github.com/evgfitil/gophermart.git/internal/models"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockIdempotencyStorage is a mock of IdempotencyStorage interface.
+type MockIdempotencyStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockIdempotencyStorageMockRecorder
+}
+
+// MockIdempotencyStorageMockRecorder is the mock recorder for MockIdempotencyStorage.
+type MockIdempotencyStorageMockRecorder struct {
+	mock *MockIdempotencyStorage
+}
+
+// NewMockIdempotencyStorage creates a new mock instance.
+func NewMockIdempotencyStorage(ctrl *gomock.Controller) *MockIdempotencyStorage {
+	mock := &MockIdempotencyStorage{ctrl: ctrl}
+	mock.recorder = &MockIdempotencyStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIdempotencyStorage) EXPECT() *MockIdempotencyStorageMockRecorder {
+	return m.recorder
+}
+
+// DeleteIdempotencyKey mocks base method.
+func (m *MockIdempotencyStorage) DeleteIdempotencyKey(ctx context.Context, scope, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteIdempotencyKey", ctx, scope, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteIdempotencyKey indicates an expected call of DeleteIdempotencyKey.
+func (mr *MockIdempotencyStorageMockRecorder) DeleteIdempotencyKey(ctx, scope, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteIdempotencyKey", reflect.TypeOf((*MockIdempotencyStorage)(nil).DeleteIdempotencyKey), ctx, scope, key)
+}
+
+// ReserveIdempotencyKey mocks base method.
+func (m *MockIdempotencyStorage) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord, ttl time.Duration) (*models.IdempotencyRecord, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReserveIdempotencyKey", ctx, record, ttl)
+	ret0, _ := ret[0].(*models.IdempotencyRecord)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReserveIdempotencyKey indicates an expected call of ReserveIdempotencyKey.
+func (mr *MockIdempotencyStorageMockRecorder) ReserveIdempotencyKey(ctx, record, ttl any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReserveIdempotencyKey", reflect.TypeOf((*MockIdempotencyStorage)(nil).ReserveIdempotencyKey), ctx, record, ttl)
+}
+
+// SaveIdempotencyResponse mocks base method.
+func (m *MockIdempotencyStorage) SaveIdempotencyResponse(ctx context.Context, record *models.IdempotencyRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveIdempotencyResponse", ctx, record)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveIdempotencyResponse indicates an expected call of SaveIdempotencyResponse.
+func (mr *MockIdempotencyStorageMockRecorder) SaveIdempotencyResponse(ctx, record any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveIdempotencyResponse", reflect.TypeOf((*MockIdempotencyStorage)(nil).SaveIdempotencyResponse), ctx, record)
+}
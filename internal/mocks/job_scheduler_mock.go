@@ -0,0 +1,86 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: internal/api/jobs.go
+//
+// Generated by this command:
+//
+//	mockgen -source=internal/api/jobs.go -destination=internal/mocks/job_scheduler_mock.go -package=mocks
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	models "github.com/evgfitil/gophermart.git/internal/models"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockJobScheduler is a mock of JobScheduler interface.
+type MockJobScheduler struct {
+	ctrl     *gomock.Controller
+	recorder *MockJobSchedulerMockRecorder
+}
+
+// MockJobSchedulerMockRecorder is the mock recorder for MockJobScheduler.
+type MockJobSchedulerMockRecorder struct {
+	mock *MockJobScheduler
+}
+
+// NewMockJobScheduler creates a new mock instance.
+func NewMockJobScheduler(ctrl *gomock.Controller) *MockJobScheduler {
+	mock := &MockJobScheduler{ctrl: ctrl}
+	mock.recorder = &MockJobSchedulerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockJobScheduler) EXPECT() *MockJobSchedulerMockRecorder {
+	return m.recorder
+}
+
+// JobRuns mocks base method.
+func (m *MockJobScheduler) JobRuns(ctx context.Context, name string, limit int) ([]models.JobRun, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "JobRuns", ctx, name, limit)
+	ret0, _ := ret[0].([]models.JobRun)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// JobRuns indicates an expected call of JobRuns.
+func (mr *MockJobSchedulerMockRecorder) JobRuns(ctx, name, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JobRuns", reflect.TypeOf((*MockJobScheduler)(nil).JobRuns), ctx, name, limit)
+}
+
+// Jobs mocks base method.
+func (m *MockJobScheduler) Jobs(ctx context.Context) ([]models.JobInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Jobs", ctx)
+	ret0, _ := ret[0].([]models.JobInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Jobs indicates an expected call of Jobs.
+func (mr *MockJobSchedulerMockRecorder) Jobs(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Jobs", reflect.TypeOf((*MockJobScheduler)(nil).Jobs), ctx)
+}
+
+// TriggerJob mocks base method.
+func (m *MockJobScheduler) TriggerJob(ctx context.Context, name string) (*models.JobRun, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TriggerJob", ctx, name)
+	ret0, _ := ret[0].(*models.JobRun)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TriggerJob indicates an expected call of TriggerJob.
+func (mr *MockJobSchedulerMockRecorder) TriggerJob(ctx, name any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TriggerJob", reflect.TypeOf((*MockJobScheduler)(nil).TriggerJob), ctx, name)
+}
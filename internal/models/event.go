@@ -0,0 +1,15 @@
+package models
+
+type Event struct {
+	Type    string   `json:"type"`
+	UserID  int      `json:"-"`
+	Order   string   `json:"order,omitempty"`
+	Status  string   `json:"status,omitempty"`
+	Accrual float64  `json:"accrual,omitempty"`
+	Balance *Balance `json:"balance,omitempty"`
+}
+
+const (
+	EventTypeOrderStatus = "order_status"
+	EventTypeBalance     = "balance"
+)
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"net/http"
+	"time"
+)
+
+// IdempotencyRecord is a stored response for an Idempotency-Key. StatusCode
+// is zero while the original request is still being processed.
+type IdempotencyRecord struct {
+	Scope       string
+	Key         string
+	RequestHash string
+	StatusCode  int
+	Header      http.Header
+	Body        []byte
+	CreatedAt   time.Time
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+const (
+	JobTriggerSchedule = "schedule"
+	JobTriggerManual   = "manual"
+
+	JobRunPending   = "pending"
+	JobRunRunning   = "running"
+	JobRunSucceeded = "succeeded"
+	JobRunFailed    = "failed"
+)
+
+// JobRun is a run of a background job. Manual runs are pending until the
+// scheduler of the leader picks them up.
+type JobRun struct {
+	ID         int64      `json:"id"`
+	Job        string     `json:"job"`
+	Trigger    string     `json:"trigger"`
+	Status     string     `json:"status"`
+	Instance   string     `json:"instance,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// JobInfo describes a registered background job and its latest run.
+type JobInfo struct {
+	Name     string  `json:"name"`
+	Schedule string  `json:"schedule"`
+	Timeout  string  `json:"timeout"`
+	LastRun  *JobRun `json:"last_run,omitempty"`
+}
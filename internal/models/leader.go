@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LeaderLease is the lease of the instance that holds a leader election.
+// The advisory lock decides who leads, the lease only tells the others.
+type LeaderLease struct {
+	Name       string    `json:"name"`
+	Holder     string    `json:"holder"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	RenewedAt  time.Time `json:"renewed_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
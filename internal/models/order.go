@@ -4,6 +4,13 @@ import (
 	"time"
 )
 
+const (
+	OrderStatusNew        = "NEW"
+	OrderStatusProcessing = "PROCESSING"
+	OrderStatusInvalid    = "INVALID"
+	OrderStatusProcessed  = "PROCESSED"
+)
+
 type Order struct {
 	ID          int       `json:"-"`
 	UserID      int       `json:"-"`
@@ -11,4 +18,60 @@ type Order struct {
 	Status      string    `json:"status"`
 	Accrual     float64   `json:"accrual,omitempty"`
 	UploadedAt  time.Time `json:"uploaded_at"`
+	Attempts    int       `json:"-"`
+}
+
+// DeadLetterOrder is an order the loyalty processor gave up on after too
+// many failed checks.
+type DeadLetterOrder struct {
+	OrderNumber    string    `json:"number"`
+	UserID         int       `json:"user_id"`
+	Status         string    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	LastError      string    `json:"last_error,omitempty"`
+	UploadedAt     time.Time `json:"uploaded_at"`
+	DeadLetteredAt time.Time `json:"dead_lettered_at"`
+}
+
+// OrderFilter selects orders for reprocessing. Empty fields match every
+// order.
+type OrderFilter struct {
+	Statuses []string
+	From     time.Time
+	To       time.Time
+	Username string
+	Numbers  []string
+}
+
+const (
+	// ReprocessActionRequeue makes an unfinished or invalid order due for a
+	// check with fresh attempts.
+	ReprocessActionRequeue = "requeue"
+	// ReprocessActionRecheck rechecks a processed order and only reports a
+	// changed accrual.
+	ReprocessActionRecheck = "recheck"
+	// ReprocessActionCorrect rechecks a processed order and posts a
+	// correction when its accrual changed.
+	ReprocessActionCorrect = "correct"
+)
+
+// ReprocessedOrder is an order selected for reprocessing and what was done
+// with it.
+type ReprocessedOrder struct {
+	OrderNumber string
+	Username    string
+	Status      string
+	Accrual     float64
+	Action      string
+}
+
+// AccrualRecheck is the outcome of a recheck of a processed order. Refused
+// is set when a correction was requested but would have taken the balance
+// of the user below zero.
+type AccrualRecheck struct {
+	Previous  float64
+	Accrual   float64
+	Changed   bool
+	Corrected bool
+	Refused   bool
 }
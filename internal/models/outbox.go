@@ -0,0 +1,22 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type OutboxEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	UserID    int             `json:"-"`
+	Payload   json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+const (
+	OutboxEventUserRegistered  = "UserRegistered"
+	OutboxEventOrderUploaded   = "OrderUploaded"
+	OutboxEventOrderProcessed  = "OrderProcessed"
+	OutboxEventOrderInvalid    = "OrderInvalid"
+	OutboxEventPointsWithdrawn = "PointsWithdrawn"
+)
@@ -14,4 +14,13 @@ type Transaction struct {
 const (
 	TransactionTypeAccrual    = "accrual"
 	TransactionTypeWithdrawal = "withdrawal"
+	// TransactionTypeCorrection adjusts the accrual of an order after the
+	// accrual system changed it. The amount may be negative.
+	TransactionTypeCorrection = "correction"
 )
+
+type LedgerTotal struct {
+	Type   string
+	Count  int
+	Amount float64
+}
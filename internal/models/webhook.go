@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+type Webhook struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"-"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int64       `json:"id"`
+	WebhookID      int         `json:"webhook_id"`
+	URL            string      `json:"-"`
+	Secret         string      `json:"-"`
+	Event          OutboxEvent `json:"event"`
+	Status         string      `json:"status"`
+	Attempts       int         `json:"attempts"`
+	ResponseStatus *int        `json:"response_status,omitempty"`
+	LastError      *string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time   `json:"created_at"`
+	DeliveredAt    *time.Time  `json:"delivered_at,omitempty"`
+}
+
+const (
+	WebhookDeliveryPending   = "PENDING"
+	WebhookDeliveryDelivered = "DELIVERED"
+	WebhookDeliveryFailed    = "FAILED"
+)
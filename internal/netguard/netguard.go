@@ -0,0 +1,94 @@
+// Package netguard keeps outgoing requests to user supplied URLs, such as
+// webhooks, away from the internal network.
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+const dialTimeout = 10 * time.Second
+
+var ErrForbiddenAddress = errors.New("address is not publicly routable")
+
+// blockedPrefixes are the ranges not covered by the netip predicates:
+// carrier-grade NAT, IETF protocol assignments, benchmarking, the reserved
+// range and NAT64 prefixes that map onto them.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// Resolver looks up the addresses of a host, as net.Resolver does.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network string, host string) ([]netip.Addr, error)
+}
+
+// IsPublic reports whether ip is a publicly routable unicast address. It
+// rejects loopback, private, link-local, including the cloud metadata
+// address 169.254.169.254, multicast and reserved addresses.
+func IsPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsUnspecified() || ip.IsLoopback() || ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckHost resolves host and fails unless all its addresses are public.
+func CheckHost(ctx context.Context, resolver Resolver, host string) error {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return checkAddr(ip)
+	}
+	addrs, err := resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("error resolving %s: %w", host, err)
+	}
+	for _, ip := range addrs {
+		if err = checkAddr(ip); err != nil {
+			return fmt.Errorf("%s resolves to %w", host, err)
+		}
+	}
+	return nil
+}
+
+func checkAddr(ip netip.Addr) error {
+	if !IsPublic(ip) {
+		return fmt.Errorf("%s: %w", ip, ErrForbiddenAddress)
+	}
+	return nil
+}
+
+// DialContext dials like net.Dialer but refuses connections to addresses
+// that are not public. The address is checked after resolution, right
+// before connecting, so a host that resolves to a public address when it is
+// validated and to an internal one later is still refused.
+func DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout: dialTimeout,
+		Control: func(_ string, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			return checkAddr(addrPort.Addr())
+		},
+	}
+	return dialer.DialContext(ctx, network, address)
+}
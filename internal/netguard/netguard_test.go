@@ -0,0 +1,77 @@
+package netguard
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticResolver map[string][]netip.Addr
+
+func (r staticResolver) LookupNetIP(_ context.Context, _ string, host string) ([]netip.Addr, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "93.184.216.34", want: true},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{ip: "127.0.0.1", want: false},
+		{ip: "::1", want: false},
+		{ip: "10.1.2.3", want: false},
+		{ip: "172.16.0.1", want: false},
+		{ip: "192.168.1.1", want: false},
+		{ip: "169.254.169.254", want: false},
+		{ip: "fe80::1", want: false},
+		{ip: "fd00:ec2::254", want: false},
+		{ip: "100.64.0.1", want: false},
+		{ip: "0.0.0.0", want: false},
+		{ip: "::ffff:127.0.0.1", want: false},
+		{ip: "64:ff9b::a9fe:a9fe", want: false},
+		{ip: "224.0.0.1", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsPublic(netip.MustParseAddr(tt.ip)))
+		})
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	resolver := staticResolver{
+		"partner.example":  {netip.MustParseAddr("93.184.216.34")},
+		"internal.example": {netip.MustParseAddr("93.184.216.34"), netip.MustParseAddr("10.0.0.5")},
+	}
+	ctx := context.Background()
+
+	assert.NoError(t, CheckHost(ctx, resolver, "partner.example"))
+	assert.ErrorIs(t, CheckHost(ctx, resolver, "internal.example"), ErrForbiddenAddress)
+	assert.ErrorIs(t, CheckHost(ctx, resolver, "169.254.169.254"), ErrForbiddenAddress)
+	assert.Error(t, CheckHost(ctx, resolver, "missing.example"))
+}
+
+func TestDialContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		t.Error("a loopback server must not be reached")
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http.Transport{DialContext: DialContext}}
+	_, err := client.Get(ts.URL)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+}
@@ -0,0 +1,42 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+// FilePublisher appends every message as a JSON line to a file.
+type FilePublisher struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FilePublisher{file: file}, nil
+}
+
+func (fp *FilePublisher) Publish(_ context.Context, event models.OutboxEvent) error {
+	data, err := json.Marshal(NewMessage(event))
+	if err != nil {
+		return err
+	}
+
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	if _, err = fp.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return fp.file.Sync()
+}
+
+func (fp *FilePublisher) Close() error {
+	return fp.file.Close()
+}
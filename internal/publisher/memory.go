@@ -0,0 +1,36 @@
+package publisher
+
+import (
+	"context"
+	"sync"
+
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+// MemoryPublisher keeps published messages in memory. It is meant for tests
+// and local runs where no message bus is available.
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (mp *MemoryPublisher) Publish(_ context.Context, event models.OutboxEvent) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.messages = append(mp.messages, NewMessage(event))
+	return nil
+}
+
+func (mp *MemoryPublisher) Messages() []Message {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return append([]Message(nil), mp.messages...)
+}
+
+func (mp *MemoryPublisher) Close() error {
+	return nil
+}
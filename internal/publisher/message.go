@@ -0,0 +1,27 @@
+package publisher
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+// Message is the envelope every publisher puts on the wire.
+type Message struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	UserID    int             `json:"user_id"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+func NewMessage(event models.OutboxEvent) Message {
+	return Message{
+		ID:        event.ID,
+		Type:      event.Type,
+		UserID:    event.UserID,
+		Data:      event.Payload,
+		CreatedAt: event.CreatedAt,
+	}
+}
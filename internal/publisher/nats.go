@@ -0,0 +1,55 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+const (
+	defaultSubjectPrefix = "gophermart"
+	natsFlushTimeout     = 5 * time.Second
+)
+
+// NATSPublisher publishes events to "<prefix>.<event type>" subjects. The
+// outbox event id is sent as Nats-Msg-Id, so JetStream streams deduplicate
+// events that are redelivered after a relay failure.
+type NATSPublisher struct {
+	conn          *nats.Conn
+	subjectPrefix string
+}
+
+func NewNATSPublisher(url string) (*NATSPublisher, error) {
+	conn, err := nats.Connect(url, nats.Name("gophermart"))
+	if err != nil {
+		return nil, err
+	}
+	return &NATSPublisher{conn: conn, subjectPrefix: defaultSubjectPrefix}, nil
+}
+
+func (np *NATSPublisher) Publish(ctx context.Context, event models.OutboxEvent) error {
+	data, err := json.Marshal(NewMessage(event))
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(np.subjectPrefix + "." + event.Type)
+	msg.Header.Set(nats.MsgIdHdr, strconv.FormatInt(event.ID, 10))
+	msg.Data = data
+	if err = np.conn.PublishMsg(msg); err != nil {
+		return err
+	}
+
+	flushCtx, cancel := context.WithTimeout(ctx, natsFlushTimeout)
+	defer cancel()
+	return np.conn.FlushWithContext(flushCtx)
+}
+
+func (np *NATSPublisher) Close() error {
+	return np.conn.Drain()
+}
@@ -0,0 +1,185 @@
+package publisher
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+var testEvents = []models.OutboxEvent{
+	{ID: 1, Type: models.OutboxEventUserRegistered, UserID: 1, Payload: json.RawMessage(`{"login":"test_user"}`), CreatedAt: time.Unix(1700000000, 0).UTC()},
+	{ID: 2, Type: models.OutboxEventOrderUploaded, UserID: 1, Payload: json.RawMessage(`{"order":"12345678903","status":"NEW"}`), CreatedAt: time.Unix(1700000001, 0).UTC()},
+}
+
+func TestMemoryPublisher(t *testing.T) {
+	mp := NewMemoryPublisher()
+	for _, event := range testEvents {
+		require.NoError(t, mp.Publish(context.Background(), event))
+	}
+
+	messages := mp.Messages()
+	require.Len(t, messages, len(testEvents))
+	for i, event := range testEvents {
+		assert.Equal(t, NewMessage(event), messages[i])
+	}
+}
+
+func TestFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	fp, err := NewFilePublisher(path)
+	require.NoError(t, err)
+	for _, event := range testEvents {
+		require.NoError(t, fp.Publish(context.Background(), event))
+	}
+	require.NoError(t, fp.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var messages []Message
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var message Message
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &message))
+		messages = append(messages, message)
+	}
+	require.NoError(t, scanner.Err())
+
+	require.Len(t, messages, len(testEvents))
+	for i, event := range testEvents {
+		assert.Equal(t, event.ID, messages[i].ID)
+		assert.Equal(t, event.Type, messages[i].Type)
+		assert.Equal(t, event.UserID, messages[i].UserID)
+		assert.JSONEq(t, string(event.Payload), string(messages[i].Data))
+		assert.True(t, event.CreatedAt.Equal(messages[i].CreatedAt))
+	}
+}
+
+type natsMessage struct {
+	subject string
+	header  http.Header
+	data    []byte
+}
+
+// fakeNATSServer speaks just enough of the NATS client protocol to accept
+// connections and record published messages.
+type fakeNATSServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []natsMessage
+}
+
+func newFakeNATSServer(t *testing.T) *fakeNATSServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeNATSServer{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeNATSServer) URL() string {
+	return "nats://" + s.listener.Addr().String()
+}
+
+func (s *fakeNATSServer) Messages() []natsMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]natsMessage(nil), s.messages...)
+}
+
+func (s *fakeNATSServer) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"version\":\"2.10.0\",\"headers\":true,\"max_payload\":1048576}\r\n")
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "PING":
+			fmt.Fprintf(conn, "PONG\r\n")
+		case "HPUB":
+			// HPUB <subject> <header size> <total size>
+			headerSize, _ := strconv.Atoi(fields[2])
+			totalSize, _ := strconv.Atoi(fields[3])
+			payload := make([]byte, totalSize+2)
+			if _, err = io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			header := make(http.Header)
+			for _, headerLine := range strings.Split(string(payload[:headerSize]), "\r\n")[1:] {
+				if name, value, ok := strings.Cut(headerLine, ":"); ok {
+					header.Add(name, strings.TrimSpace(value))
+				}
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, natsMessage{subject: fields[1], header: header, data: payload[headerSize:totalSize]})
+			s.mu.Unlock()
+		}
+	}
+}
+
+func TestNATSPublisher(t *testing.T) {
+	server := newFakeNATSServer(t)
+	np, err := NewNATSPublisher(server.URL())
+	require.NoError(t, err)
+	defer np.Close()
+
+	for _, event := range testEvents {
+		require.NoError(t, np.Publish(context.Background(), event))
+	}
+
+	// Publish returns once the server has the message, so no waiting is needed
+	messages := server.Messages()
+	require.Len(t, messages, len(testEvents))
+	for i, event := range testEvents {
+		assert.Equal(t, "gophermart."+event.Type, messages[i].subject)
+		assert.Equal(t, strconv.FormatInt(event.ID, 10), messages[i].header.Get("Nats-Msg-Id"))
+		var message Message
+		require.NoError(t, json.Unmarshal(messages[i].data, &message))
+		assert.Equal(t, event.ID, message.ID)
+		assert.JSONEq(t, string(event.Payload), string(message.Data))
+	}
+}
+
+func TestNATSPublisherFlushTimeout(t *testing.T) {
+	server := newFakeNATSServer(t)
+	np, err := NewNATSPublisher(server.URL())
+	require.NoError(t, err)
+	defer np.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, np.Publish(ctx, testEvents[0]), "a publish that is not confirmed fails")
+}
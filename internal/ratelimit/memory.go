@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	sweepInterval = time.Minute
+)
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	window    time.Duration
+}
+
+// MemoryStore keeps token buckets in process memory, so every instance
+// enforces its own limits.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (ms *MemoryStore) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := ms.now()
+	ms.sweep(now)
+
+	capacity := float64(limit.Requests)
+	perToken := limit.Window / time.Duration(limit.Requests)
+	b, ok := ms.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity}
+		ms.buckets[key] = b
+	} else {
+		refill := float64(now.Sub(b.updatedAt)) / float64(perToken)
+		b.tokens = math.Min(capacity, b.tokens+refill)
+	}
+	b.updatedAt = now
+	b.window = limit.Window
+
+	result := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((capacity - b.tokens) * float64(perToken))
+	return result, nil
+}
+
+// sweep drops buckets that have been idle long enough to be full again,
+// they are indistinguishable from missing ones.
+func (ms *MemoryStore) sweep(now time.Time) {
+	if now.Sub(ms.lastSweep) < sweepInterval {
+		return
+	}
+	for key, b := range ms.buckets {
+		if now.Sub(b.updatedAt) > b.window {
+			delete(ms.buckets, key)
+		}
+	}
+	ms.lastSweep = now
+}
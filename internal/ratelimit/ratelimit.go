@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests requests per Window. Buckets refill continuously, so
+// a client that stays below the average rate is never limited.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Result is the state of a bucket after a request has been counted.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until the next request is allowed, zero when
+	// Allowed is true
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets. Implementations backed by a shared store let
+// several instances enforce one limit.
+type Store interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// ParseLimits parses a comma separated list of name=requests/window pairs,
+// e.g. "login=10/1m,orders=60/1m".
+func ParseLimits(s string) (map[string]Limit, error) {
+	limits := make(map[string]Limit)
+	if strings.TrimSpace(s) == "" {
+		return limits, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid rate limit %q, expected name=requests/window", pair)
+		}
+		requests, window, ok := strings.Cut(value, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q, expected name=requests/window", pair)
+		}
+		n, err := strconv.Atoi(requests)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid number of requests in rate limit %q", pair)
+		}
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid window in rate limit %q", pair)
+		}
+		limits[name] = Limit{Requests: n, Window: d}
+	}
+	return limits, nil
+}
+
+// ParseTrustedProxies parses a comma separated list of CIDR prefixes or
+// single addresses, e.g. "10.0.0.0/8,192.168.1.10".
+func ParseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	if strings.TrimSpace(s) == "" {
+		return prefixes, nil
+	}
+	for _, value := range strings.Split(s, ",") {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q, expected an address or a CIDR prefix", value)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q, expected an address or a CIDR prefix", value)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Requests: 2, Window: time.Minute}
+	ctx := context.Background()
+
+	result, err := store.Allow(ctx, "orders:user:alice", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+
+	result, err = store.Allow(ctx, "orders:user:alice", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, time.Minute, result.Reset)
+
+	result, err = store.Allow(ctx, "orders:user:alice", limit)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 30*time.Second, result.RetryAfter)
+
+	result, err = store.Allow(ctx, "orders:user:bob", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed, "buckets are per key")
+
+	now = now.Add(30 * time.Second)
+	result, err = store.Allow(ctx, "orders:user:alice", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed, "a token is refilled after window/requests")
+
+	now = now.Add(2 * time.Minute)
+	store.Allow(ctx, "orders:user:carol", limit)
+	assert.NotContains(t, store.buckets, "orders:user:alice", "idle buckets are swept")
+}
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]Limit
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			value: "",
+			want:  map[string]Limit{},
+		},
+		{
+			name:  "several routes",
+			value: "login=10/1m, orders_upload=60/1m",
+			want: map[string]Limit{
+				"login":         {Requests: 10, Window: time.Minute},
+				"orders_upload": {Requests: 60, Window: time.Minute},
+			},
+		},
+		{
+			name:    "missing window",
+			value:   "login=10",
+			wantErr: true,
+		},
+		{
+			name:    "zero requests",
+			value:   "login=0/1m",
+			wantErr: true,
+		},
+		{
+			name:    "invalid window",
+			value:   "login=10/minute",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLimits(tt.value)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []netip.Prefix
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			value: "",
+		},
+		{
+			name:  "prefixes and addresses",
+			value: "10.0.0.0/8, 192.168.1.10,fd00::/8",
+			want: []netip.Prefix{
+				netip.MustParsePrefix("10.0.0.0/8"),
+				netip.MustParsePrefix("192.168.1.10/32"),
+				netip.MustParsePrefix("fd00::/8"),
+			},
+		},
+		{
+			name:    "host name",
+			value:   "proxy.internal",
+			wantErr: true,
+		},
+		{
+			name:    "invalid prefix length",
+			value:   "10.0.0.0/33",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTrustedProxies(tt.value)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
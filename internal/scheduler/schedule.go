@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule tells when a job runs next.
+type Schedule interface {
+	Next(after time.Time) time.Time
+	String() string
+}
+
+type intervalSchedule time.Duration
+
+// Every runs a job every d, counted from the start of the previous run.
+func Every(d time.Duration) Schedule {
+	return intervalSchedule(d)
+}
+
+func (s intervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(s))
+}
+
+func (s intervalSchedule) String() string {
+	return "@every " + time.Duration(s).String()
+}
+
+type cronSchedule struct {
+	expr     string
+	schedule cron.Schedule
+}
+
+// Cron parses a standard five-field cron expression, such as "0 3 * * *",
+// or a descriptor, such as "@hourly". Times are in the local time zone.
+func Cron(expr string) (Schedule, error) {
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	return cronSchedule{expr: expr, schedule: schedule}, nil
+}
+
+func (s cronSchedule) Next(after time.Time) time.Time {
+	return s.schedule.Next(after)
+}
+
+func (s cronSchedule) String() string {
+	return s.expr
+}
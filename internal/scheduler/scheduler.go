@@ -0,0 +1,378 @@
+// Package scheduler runs named background jobs on interval or cron
+// schedules, records their runs and lets admins trigger them by hand.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/metrics"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+const (
+	defaultTick    = time.Second
+	defaultTimeout = 5 * time.Minute
+	// defaultClaimInterval is how often the storage is asked for manually
+	// triggered runs, which costs a query per job
+	defaultClaimInterval = 5 * time.Second
+	// recordTimeout bounds the storage calls that record a run, which are
+	// made even while the scheduler is stopping
+	recordTimeout = 5 * time.Second
+	// overdueGrace is how late a job may start before the scheduler is
+	// reported stuck
+	overdueGrace = time.Minute
+)
+
+type RunStorage interface {
+	ClaimPendingJobRun(ctx context.Context, job string, instance string) (*models.JobRun, error)
+	CreateJobRun(ctx context.Context, run *models.JobRun) error
+	FinishJobRun(ctx context.Context, id int64, status string, runErr string) error
+	GetJobRuns(ctx context.Context, job string, limit int) ([]models.JobRun, error)
+	GetLatestJobRuns(ctx context.Context) ([]models.JobRun, error)
+}
+
+// Job is a named background job. Run gets a context cancelled after Timeout
+// or when the scheduler stops. Every scheduled run starts up to Jitter late,
+// which spreads jobs with the same schedule.
+type Job struct {
+	Name     string
+	Schedule Schedule
+	Jitter   time.Duration
+	Timeout  time.Duration
+	Run      func(ctx context.Context) error
+}
+
+type scheduledJob struct {
+	Job
+	next time.Time
+	// lastFinished is when the latest run on this instance returned,
+	// whatever its outcome
+	lastFinished time.Time
+	running      atomic.Bool
+}
+
+// Scheduler runs the added jobs while Run is active. Runs of the same job
+// never overlap: a run that falls due while the previous one is still going
+// starts as soon as that one finishes, and no more than one such run is made
+// up for.
+type Scheduler struct {
+	storage       RunStorage
+	instance      string
+	tick          time.Duration
+	claimInterval time.Duration
+	now           func() time.Time
+
+	mu      sync.Mutex
+	jobs    map[string]*scheduledJob
+	active  bool
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+func New(storage RunStorage, instance string) *Scheduler {
+	return &Scheduler{
+		storage:       storage,
+		instance:      instance,
+		tick:          defaultTick,
+		claimInterval: defaultClaimInterval,
+		now:           time.Now,
+		jobs:          make(map[string]*scheduledJob),
+	}
+}
+
+// Add registers a job. Jobs are added before the scheduler runs.
+func (s *Scheduler) Add(job Job) error {
+	if job.Name == "" || job.Schedule == nil || job.Run == nil {
+		return errors.New("job needs a name, a schedule and a run function")
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = defaultTimeout
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("job %s is already added", job.Name)
+	}
+	s.jobs[job.Name] = &scheduledJob{Job: job}
+	return nil
+}
+
+// Start runs the scheduler in the background until Stop.
+func (s *Scheduler) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	s.mu.Lock()
+	s.cancel, s.stopped = cancel, stopped
+	s.mu.Unlock()
+
+	go func() {
+		defer close(stopped)
+		s.Run(ctx)
+	}()
+}
+
+// Stop cancels the running jobs and waits for them to return or for ctx to
+// expire, whichever comes first.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	cancel, stopped := s.cancel, s.stopped
+	s.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run runs due jobs until ctx is cancelled, then waits for the runs in
+// progress. Manually triggered runs are picked up every claimInterval.
+func (s *Scheduler) Run(ctx context.Context) {
+	logger.Sugar.Infoln("Starting job scheduler")
+	jobs := s.scheduledJobs()
+
+	s.mu.Lock()
+	s.active = true
+	now := s.now()
+	for _, job := range jobs {
+		job.next = s.nextRun(job, now)
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.active = false
+		s.mu.Unlock()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+	var lastClaim time.Time
+	for {
+		claim := s.now().Sub(lastClaim) >= s.claimInterval
+		if claim {
+			lastClaim = s.now()
+		}
+		for _, job := range jobs {
+			s.dispatch(ctx, &wg, job, claim)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch starts a manually triggered run of the job if claim is set and
+// one is pending, or a scheduled run if it is due.
+func (s *Scheduler) dispatch(ctx context.Context, wg *sync.WaitGroup, job *scheduledJob, claim bool) {
+	if job.running.Load() {
+		return
+	}
+
+	var run *models.JobRun
+	if claim {
+		var err error
+		run, err = s.storage.ClaimPendingJobRun(ctx, job.Name, s.instance)
+		if err != nil && ctx.Err() == nil {
+			logger.Sugar.Errorf("error claiming runs of job %s: %v", job.Name, err)
+		}
+	}
+
+	s.mu.Lock()
+	now := s.now()
+	due := !now.Before(job.next)
+	if due {
+		job.next = s.nextRun(job, now)
+	}
+	s.mu.Unlock()
+	if run == nil && !due {
+		return
+	}
+
+	job.running.Store(true)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer job.running.Store(false)
+		s.execute(ctx, job, run)
+	}()
+}
+
+func (s *Scheduler) nextRun(job *scheduledJob, now time.Time) time.Time {
+	next := job.Schedule.Next(now)
+	if job.Jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(job.Jitter))))
+	}
+	return next
+}
+
+// execute runs the job once, recording a new scheduled run unless run is a
+// claimed manual one.
+func (s *Scheduler) execute(ctx context.Context, job *scheduledJob, run *models.JobRun) {
+	if run == nil {
+		run = &models.JobRun{Job: job.Name, Trigger: models.JobTriggerSchedule, Status: models.JobRunRunning, Instance: s.instance}
+		recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), recordTimeout)
+		if err := s.storage.CreateJobRun(recordCtx, run); err != nil {
+			// the job still runs, only its history is incomplete
+			logger.Sugar.Errorf("error recording run of job %s: %v", job.Name, err)
+		}
+		cancel()
+	}
+
+	log := logger.Sugar.With("job", job.Name, "trigger", run.Trigger)
+	log.Debugln("job started")
+	start := time.Now()
+	err := s.runJob(ctx, job)
+	duration := time.Since(start)
+	s.mu.Lock()
+	job.lastFinished = s.now()
+	s.mu.Unlock()
+
+	status := models.JobRunSucceeded
+	var runErr string
+	if err != nil {
+		status = models.JobRunFailed
+		runErr = err.Error()
+		log.Errorw("job failed", "error", err, "duration", duration)
+	} else {
+		log.Debugw("job finished", "duration", duration)
+	}
+	metrics.JobRunsTotal.WithLabelValues(job.Name, status).Inc()
+	metrics.JobRunDuration.WithLabelValues(job.Name).Observe(duration.Seconds())
+
+	if run.ID == 0 {
+		return
+	}
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), recordTimeout)
+	defer cancel()
+	if err = s.storage.FinishJobRun(recordCtx, run.ID, status, runErr); err != nil {
+		log.Errorf("error recording outcome of job: %v", err)
+	}
+}
+
+// runJob calls the job with its timeout and turns a panic into an error.
+func (s *Scheduler) runJob(ctx context.Context, job *scheduledJob) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, job.Timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Sugar.Errorf("job %s panicked: %v\n%s", job.Name, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+func (s *Scheduler) scheduledJobs() []*scheduledJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]*scheduledJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+// Jobs describes the added jobs with their latest runs on any instance.
+func (s *Scheduler) Jobs(ctx context.Context) ([]models.JobInfo, error) {
+	latest, err := s.storage.GetLatestJobRuns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lastRuns := make(map[string]models.JobRun, len(latest))
+	for _, run := range latest {
+		lastRuns[run.Job] = run
+	}
+
+	var infos []models.JobInfo
+	for _, job := range s.scheduledJobs() {
+		info := models.JobInfo{Name: job.Name, Schedule: job.Schedule.String(), Timeout: job.Timeout.String()}
+		if run, ok := lastRuns[job.Name]; ok {
+			info.LastRun = &run
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// TriggerJob requests a run of the job. The run is pending until the
+// scheduler of the leader picks it up, which may be on another instance.
+func (s *Scheduler) TriggerJob(ctx context.Context, name string) (*models.JobRun, error) {
+	if !s.hasJob(name) {
+		return nil, apperrors.ErrJobNotFound
+	}
+	run := &models.JobRun{Job: name, Trigger: models.JobTriggerManual, Status: models.JobRunPending}
+	if err := s.storage.CreateJobRun(ctx, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// JobRuns returns up to limit latest runs of the job, newest first.
+func (s *Scheduler) JobRuns(ctx context.Context, name string, limit int) ([]models.JobRun, error) {
+	if !s.hasJob(name) {
+		return nil, apperrors.ErrJobNotFound
+	}
+	return s.storage.GetJobRuns(ctx, name, limit)
+}
+
+func (s *Scheduler) hasJob(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.jobs[name]
+	return ok
+}
+
+// CheckJobs reports the next run of every job and how long ago its last run
+// finished, and fails if a job is overdue, which means the scheduler is
+// stuck. An instance that is not the
+// leader does not run the scheduler and is not reported down.
+func (s *Scheduler) CheckJobs(_ context.Context) (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.active {
+		return map[string]any{"running": false}, nil
+	}
+
+	now := s.now()
+	details := map[string]any{"running": true}
+	var overdue []string
+	for name, job := range s.jobs {
+		jobDetails := map[string]any{"next_run": job.next.Format(time.RFC3339), "running": job.running.Load()}
+		if !job.lastFinished.IsZero() {
+			jobDetails["last_run"] = job.lastFinished.Format(time.RFC3339)
+			jobDetails["age_seconds"] = int(now.Sub(job.lastFinished).Seconds())
+		}
+		details[name] = jobDetails
+		if now.After(job.next.Add(job.Timeout + overdueGrace)) {
+			overdue = append(overdue, name)
+		}
+	}
+	if len(overdue) > 0 {
+		sort.Strings(overdue)
+		return details, fmt.Errorf("jobs are overdue: %v", overdue)
+	}
+	return details, nil
+}
@@ -0,0 +1,260 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+type memoryRunStorage struct {
+	mu     sync.Mutex
+	runs   []models.JobRun
+	claims int
+}
+
+func (s *memoryRunStorage) ClaimPendingJobRun(_ context.Context, job string, instance string) (*models.JobRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.claims++
+	for i := range s.runs {
+		if s.runs[i].Job == job && s.runs[i].Status == models.JobRunPending {
+			now := time.Now()
+			s.runs[i].Status = models.JobRunRunning
+			s.runs[i].Instance = instance
+			s.runs[i].StartedAt = &now
+			run := s.runs[i]
+			return &run, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryRunStorage) CreateJobRun(_ context.Context, run *models.JobRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run.ID = int64(len(s.runs) + 1)
+	run.CreatedAt = time.Now()
+	s.runs = append(s.runs, *run)
+	return nil
+}
+
+func (s *memoryRunStorage) FinishJobRun(_ context.Context, id int64, status string, runErr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.runs[id-1].Status = status
+	s.runs[id-1].Error = runErr
+	s.runs[id-1].FinishedAt = &now
+	return nil
+}
+
+func (s *memoryRunStorage) GetJobRuns(_ context.Context, job string, limit int) ([]models.JobRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := make([]models.JobRun, 0)
+	for i := len(s.runs) - 1; i >= 0 && len(runs) < limit; i-- {
+		if s.runs[i].Job == job {
+			runs = append(runs, s.runs[i])
+		}
+	}
+	return runs, nil
+}
+
+func (s *memoryRunStorage) GetLatestJobRuns(_ context.Context) ([]models.JobRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	latest := make(map[string]models.JobRun)
+	for _, run := range s.runs {
+		latest[run.Job] = run
+	}
+	runs := make([]models.JobRun, 0, len(latest))
+	for _, run := range latest {
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+func (s *memoryRunStorage) finished(job string, status string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, run := range s.runs {
+		if run.Job == job && run.Status == status && run.FinishedAt != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func newTestScheduler(storage RunStorage) *Scheduler {
+	s := New(storage, "test")
+	s.tick = 5 * time.Millisecond
+	s.claimInterval = 5 * time.Millisecond
+	return s
+}
+
+func TestSchedulerRunsJobs(t *testing.T) {
+	storage := &memoryRunStorage{}
+	s := newTestScheduler(storage)
+	var runs atomic.Int32
+	require.NoError(t, s.Add(Job{Name: "ok", Schedule: Every(10 * time.Millisecond), Run: func(context.Context) error {
+		runs.Add(1)
+		return nil
+	}}))
+	require.NoError(t, s.Add(Job{Name: "failing", Schedule: Every(10 * time.Millisecond), Run: func(context.Context) error {
+		return errors.New("accrual system is down")
+	}}))
+	require.NoError(t, s.Add(Job{Name: "panicking", Schedule: Every(10 * time.Millisecond), Run: func(context.Context) error {
+		panic("nil map")
+	}}))
+	require.NoError(t, s.Add(Job{Name: "slow", Schedule: Every(10 * time.Millisecond), Timeout: 10 * time.Millisecond, Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}))
+
+	ctx := context.Background()
+	s.Start(ctx)
+	require.Eventually(t, func() bool {
+		return storage.finished("ok", models.JobRunSucceeded) >= 2 &&
+			storage.finished("failing", models.JobRunFailed) >= 1 &&
+			storage.finished("panicking", models.JobRunFailed) >= 1 &&
+			storage.finished("slow", models.JobRunFailed) >= 1
+	}, time.Second, 5*time.Millisecond)
+
+	details, err := s.CheckJobs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, true, details["running"])
+	// readiness shows how long ago the job last finished, failed or not
+	for _, name := range []string{"ok", "failing"} {
+		jobDetails := details[name].(map[string]any)
+		assert.Contains(t, jobDetails, "last_run", name)
+		assert.Less(t, jobDetails["age_seconds"], 2, name)
+	}
+
+	require.NoError(t, s.Stop(ctx))
+	details, err = s.CheckJobs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"running": false}, details)
+
+	failed, err := s.JobRuns(ctx, "panicking", 1)
+	require.NoError(t, err)
+	require.Len(t, failed, 1)
+	assert.Equal(t, "panic: nil map", failed[0].Error)
+	assert.Equal(t, models.JobTriggerSchedule, failed[0].Trigger)
+
+	// the latest run may have been cancelled by Stop, the oldest timed out
+	timedOut, err := s.JobRuns(ctx, "slow", 100)
+	require.NoError(t, err)
+	require.NotEmpty(t, timedOut)
+	assert.Equal(t, context.DeadlineExceeded.Error(), timedOut[len(timedOut)-1].Error)
+}
+
+func TestSchedulerTriggerJob(t *testing.T) {
+	storage := &memoryRunStorage{}
+	s := newTestScheduler(storage)
+	var runs atomic.Int32
+	require.NoError(t, s.Add(Job{Name: "cleanup", Schedule: Every(time.Hour), Run: func(context.Context) error {
+		runs.Add(1)
+		return nil
+	}}))
+	assert.Error(t, s.Add(Job{Name: "cleanup", Schedule: Every(time.Hour), Run: func(context.Context) error { return nil }}))
+
+	ctx := context.Background()
+	_, err := s.TriggerJob(ctx, "missing")
+	assert.ErrorIs(t, err, apperrors.ErrJobNotFound)
+
+	// a run triggered before the scheduler starts waits for it
+	run, err := s.TriggerJob(ctx, "cleanup")
+	require.NoError(t, err)
+	assert.Equal(t, models.JobRunPending, run.Status)
+	assert.Equal(t, models.JobTriggerManual, run.Trigger)
+
+	s.Start(ctx)
+	defer s.Stop(ctx)
+	require.Eventually(t, func() bool {
+		return storage.finished("cleanup", models.JobRunSucceeded) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(1), runs.Load())
+
+	jobs, err := s.Jobs(ctx)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "@every 1h0m0s", jobs[0].Schedule)
+	assert.Equal(t, defaultTimeout.String(), jobs[0].Timeout)
+	require.NotNil(t, jobs[0].LastRun)
+	assert.Equal(t, "test", jobs[0].LastRun.Instance)
+	assert.Equal(t, models.JobTriggerManual, jobs[0].LastRun.Trigger)
+}
+
+func TestSchedulerClaimInterval(t *testing.T) {
+	storage := &memoryRunStorage{}
+	s := newTestScheduler(storage)
+	s.claimInterval = 50 * time.Millisecond
+	require.NoError(t, s.Add(Job{Name: "cleanup", Schedule: Every(time.Hour), Run: func(context.Context) error { return nil }}))
+
+	ctx := context.Background()
+	s.Start(ctx)
+	time.Sleep(120 * time.Millisecond)
+	require.NoError(t, s.Stop(ctx))
+
+	// the scheduler ticks every 5ms but asks for manual runs every 50ms only
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	assert.GreaterOrEqual(t, storage.claims, 2)
+	assert.LessOrEqual(t, storage.claims, 4)
+}
+
+func TestSchedulerDoesNotOverlapRuns(t *testing.T) {
+	s := newTestScheduler(&memoryRunStorage{})
+	var running atomic.Int32
+	var runs atomic.Int32
+	require.NoError(t, s.Add(Job{Name: "slow", Schedule: Every(time.Millisecond), Run: func(context.Context) error {
+		runs.Add(1)
+		assert.Equal(t, int32(1), running.Add(1), "runs of a job must not overlap")
+		time.Sleep(20 * time.Millisecond)
+		running.Add(-1)
+		return nil
+	}}))
+
+	ctx := context.Background()
+	s.Start(ctx)
+	require.Eventually(t, func() bool { return runs.Load() >= 3 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, s.Stop(ctx))
+	assert.Equal(t, int32(0), running.Load())
+}
+
+func TestSchedulerCheckJobsOverdue(t *testing.T) {
+	s := newTestScheduler(&memoryRunStorage{})
+	require.NoError(t, s.Add(Job{Name: "poll", Schedule: Every(time.Hour), Timeout: time.Minute, Run: func(context.Context) error { return nil }}))
+
+	// a running scheduler whose job should have started long ago is stuck
+	s.active = true
+	s.jobs["poll"].next = time.Now().Add(-time.Hour)
+	details, err := s.CheckJobs(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, details, "poll")
+
+	s.jobs["poll"].next = time.Now().Add(time.Hour)
+	_, err = s.CheckJobs(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestCron(t *testing.T) {
+	schedule, err := Cron("0 3 * * *")
+	require.NoError(t, err)
+	assert.Equal(t, "0 3 * * *", schedule.String())
+	after := time.Date(2024, 5, 1, 4, 0, 0, 0, time.Local)
+	assert.Equal(t, time.Date(2024, 5, 2, 3, 0, 0, 0, time.Local), schedule.Next(after))
+
+	_, err = Cron("every day")
+	assert.Error(t, err)
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	cb := newCircuitBreaker(2, time.Minute)
+	cb.now = func() time.Time { return now }
+
+	assert.True(t, cb.Allow())
+	cb.Failure()
+	assert.True(t, cb.Allow())
+	cb.Success()
+	assert.True(t, cb.Allow())
+	cb.Failure()
+	state, failures, _ := cb.State()
+	assert.Equal(t, circuitClosed, state, "a success resets the failure count")
+	assert.Equal(t, 1, failures)
+
+	assert.True(t, cb.Allow())
+	cb.Failure()
+	state, _, _ = cb.State()
+	assert.Equal(t, circuitOpen, state)
+	assert.False(t, cb.Allow())
+
+	now = now.Add(time.Minute)
+	state, _, _ = cb.State()
+	assert.Equal(t, circuitHalfOpen, state)
+	assert.True(t, cb.Allow())
+	assert.False(t, cb.Allow(), "only one probe at a time")
+	cb.Failure()
+	state, _, _ = cb.State()
+	assert.Equal(t, circuitOpen, state, "a failed probe opens the circuit again")
+
+	now = now.Add(time.Minute)
+	assert.True(t, cb.Allow())
+	cb.Release()
+	assert.True(t, cb.Allow(), "a released probe lets the next one through")
+	cb.Success()
+	state, failures, _ = cb.State()
+	assert.Equal(t, circuitClosed, state)
+	assert.Equal(t, 0, failures)
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := retryPolicy{maxAttempts: 10, baseDelay: time.Second, maxDelay: 10 * time.Second}
+
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{attempt: 1, max: time.Second},
+		{attempt: 2, max: 2 * time.Second},
+		{attempt: 3, max: 4 * time.Second},
+		{attempt: 5, max: 10 * time.Second},
+		{attempt: 100, max: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			delay := p.delay(tt.attempt)
+			assert.GreaterOrEqual(t, delay, tt.max/2, "attempt %d", tt.attempt)
+			assert.LessOrEqual(t, delay, tt.max, "attempt %d", tt.attempt)
+		}
+	}
+}
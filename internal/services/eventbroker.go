@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+const (
+	listenerReconnectDelay = 2 * time.Second
+	subscriberBufferSize   = 16
+)
+
+type UserEventListener interface {
+	ListenUserEvents(ctx context.Context, handle func(models.Event)) error
+}
+
+// EventBroker fans out user events received from the database to the
+// subscribers connected to this instance.
+type EventBroker struct {
+	worker
+	listener    UserEventListener
+	mu          sync.RWMutex
+	subscribers map[int]map[chan models.Event]struct{}
+	closed      bool
+}
+
+func NewEventBroker(l UserEventListener) *EventBroker {
+	return &EventBroker{
+		listener:    l,
+		subscribers: make(map[int]map[chan models.Event]struct{}),
+	}
+}
+
+// Subscribe registers a subscriber for events of the given user. The returned
+// function must be called to release the subscription.
+func (eb *EventBroker) Subscribe(userID int) (<-chan models.Event, func()) {
+	ch := make(chan models.Event, subscriberBufferSize)
+
+	eb.mu.Lock()
+	if eb.closed {
+		eb.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	if eb.subscribers[userID] == nil {
+		eb.subscribers[userID] = make(map[chan models.Event]struct{})
+	}
+	eb.subscribers[userID][ch] = struct{}{}
+	eb.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			eb.mu.Lock()
+			defer eb.mu.Unlock()
+			if _, ok := eb.subscribers[userID][ch]; !ok {
+				return
+			}
+			delete(eb.subscribers[userID], ch)
+			if len(eb.subscribers[userID]) == 0 {
+				delete(eb.subscribers, userID)
+			}
+			close(ch)
+		})
+	}
+	return ch, unsubscribe
+}
+
+func (eb *EventBroker) publish(event models.Event) {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+
+	for ch := range eb.subscribers[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+			logger.Sugar.Warnf("dropping %s event for slow subscriber of user %d", event.Type, event.UserID)
+		}
+	}
+}
+
+// CloseSubscriptions closes all subscriber channels and rejects new
+// subscriptions, so that streaming handlers return on server shutdown.
+func (eb *EventBroker) CloseSubscriptions() {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	eb.closed = true
+	for userID, channels := range eb.subscribers {
+		for ch := range channels {
+			close(ch)
+		}
+		delete(eb.subscribers, userID)
+	}
+}
+
+func (eb *EventBroker) Start(ctx context.Context) {
+	logger.Sugar.Infoln("Starting eventBroker")
+	eb.start(ctx, func(ctx context.Context) {
+		for {
+			err := eb.listener.ListenUserEvents(ctx, eb.publish)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil && !errors.Is(err, context.Canceled) {
+				logger.Sugar.Errorf("user events listener stopped, reconnecting in %v: %v", listenerReconnectDelay, err)
+			}
+
+			if sleep(ctx, listenerReconnectDelay) != nil {
+				return
+			}
+		}
+	})
+}
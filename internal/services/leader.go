@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/metrics"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+const (
+	leaderReleaseTimeout = 5 * time.Second
+	// leaderRenewalsPerLease is how many times the leader renews its lease
+	// within the lease duration
+	leaderRenewalsPerLease = 3
+)
+
+type LeaderStorage interface {
+	GetLeaderLease(ctx context.Context, name string) (*models.LeaderLease, error)
+	ReleaseLeaderLock(ctx context.Context, name string) error
+	RenewLeaderLock(ctx context.Context, name string, holder string, ttl time.Duration) error
+	TryLeaderLock(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error)
+}
+
+// LeaderJob runs on the leader until ctx is cancelled, which happens when
+// the instance loses leadership or stops.
+type LeaderJob func(ctx context.Context)
+
+type leaderJob struct {
+	name string
+	run  LeaderJob
+}
+
+// LeaderElector makes one of the instances sharing the database the leader
+// and runs the registered jobs only there. The leader renews its lease
+// several times per lease duration and stops its jobs as soon as a renewal
+// fails. Another instance takes over once the leader has stepped down or
+// its lease has expired, so the jobs never overlap as long as they stop
+// within a third of the lease.
+type LeaderElector struct {
+	worker
+	storage LeaderStorage
+	name    string
+	holder  string
+	lease   time.Duration
+
+	mu   sync.Mutex
+	jobs []leaderJob
+
+	leader atomic.Bool
+}
+
+func NewLeaderElector(storage LeaderStorage, name string, holder string, lease time.Duration) *LeaderElector {
+	return &LeaderElector{
+		storage: storage,
+		name:    name,
+		holder:  holder,
+		lease:   lease,
+	}
+}
+
+// Register adds a job to run while the instance leads. Jobs are registered
+// before Start.
+func (e *LeaderElector) Register(name string, job LeaderJob) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.jobs = append(e.jobs, leaderJob{name: name, run: job})
+}
+
+// IsLeader reports whether the instance currently leads.
+func (e *LeaderElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Start campaigns for leadership until Stop, which also steps down.
+func (e *LeaderElector) Start(ctx context.Context) {
+	logger.Sugar.Infof("Starting leader election %s as %s", e.name, e.holder)
+	e.start(ctx, e.campaign)
+}
+
+func (e *LeaderElector) campaign(ctx context.Context) {
+	renewInterval := e.lease / leaderRenewalsPerLease
+	var stopJobs func()
+	defer func() {
+		if stopJobs != nil {
+			e.stepDown(stopJobs)
+		}
+	}()
+
+	for {
+		if stopJobs == nil {
+			if e.tryLead(ctx) {
+				stopJobs = e.runJobs(ctx)
+			}
+		} else if err := e.renew(ctx, renewInterval); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Sugar.Errorf("lost leadership of %s: %v", e.name, err)
+			e.stepDown(stopJobs)
+			stopJobs = nil
+		}
+
+		if sleep(ctx, renewInterval) != nil {
+			return
+		}
+	}
+}
+
+func (e *LeaderElector) tryLead(ctx context.Context) bool {
+	lockCtx, cancel := context.WithTimeout(ctx, e.lease/leaderRenewalsPerLease)
+	defer cancel()
+	leader, err := e.storage.TryLeaderLock(lockCtx, e.name, e.holder, e.lease)
+	if err != nil {
+		logger.Sugar.Errorf("error campaigning for leadership of %s: %v", e.name, err)
+		return false
+	}
+	if leader {
+		logger.Sugar.Infof("became the leader of %s", e.name)
+		e.leader.Store(true)
+		metrics.LeaderTransitionsTotal.WithLabelValues("acquired").Inc()
+	}
+	return leader
+}
+
+// renew extends the lease, giving up early enough for the jobs to stop
+// before the lease expires.
+func (e *LeaderElector) renew(ctx context.Context, timeout time.Duration) error {
+	renewCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return e.storage.RenewLeaderLock(renewCtx, e.name, e.holder, e.lease)
+}
+
+// runJobs starts every registered job and returns the function that stops
+// them and waits for them to return.
+func (e *LeaderElector) runJobs(ctx context.Context) func() {
+	e.mu.Lock()
+	jobs := append([]leaderJob(nil), e.jobs...)
+	e.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job leaderJob) {
+			defer wg.Done()
+			logger.Sugar.Infof("starting leader job %s", job.name)
+			job.run(ctx)
+			logger.Sugar.Infof("leader job %s stopped", job.name)
+		}(job)
+	}
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// stepDown stops the jobs and only then releases the lock, so that the next
+// leader never runs them at the same time.
+func (e *LeaderElector) stepDown(stopJobs func()) {
+	stopJobs()
+	e.leader.Store(false)
+	metrics.LeaderTransitionsTotal.WithLabelValues("released").Inc()
+
+	ctx, cancel := context.WithTimeout(context.Background(), leaderReleaseTimeout)
+	defer cancel()
+	if err := e.storage.ReleaseLeaderLock(ctx, e.name); err != nil {
+		logger.Sugar.Errorf("error releasing leadership of %s: %v", e.name, err)
+	}
+}
+
+// CheckLeader reports the current leader and its lease. It fails only if
+// the lease cannot be read, a missing leader does not make this instance
+// unready.
+func (e *LeaderElector) CheckLeader(ctx context.Context) (map[string]any, error) {
+	lease, err := e.storage.GetLeaderLease(ctx, e.name)
+	if err != nil {
+		return nil, err
+	}
+	details := map[string]any{"instance": e.holder, "is_leader": e.IsLeader()}
+	if lease == nil {
+		details["leader"] = nil
+		return details, nil
+	}
+	details["leader"] = lease.Holder
+	details["acquired_at"] = lease.AcquiredAt.Format(time.RFC3339)
+	details["renewed_at"] = lease.RenewedAt.Format(time.RFC3339)
+	details["lease_expires_at"] = lease.ExpiresAt.Format(time.RFC3339)
+	if time.Now().After(lease.ExpiresAt) {
+		details["lease_expired"] = true
+	}
+	return details, nil
+}
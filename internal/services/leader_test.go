@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+// memoryLeaderStorage is a single lease shared by the electors of a test,
+// standing in for a Postgres advisory lock and the lease recorded with it.
+// A lease left behind by a leader that lost its connection can be taken over
+// once it expires.
+type memoryLeaderStorage struct {
+	mu    sync.Mutex
+	lease *models.LeaderLease
+	fail  bool
+}
+
+func (s *memoryLeaderStorage) GetLeaderLease(_ context.Context, _ string) (*models.LeaderLease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lease == nil {
+		return nil, nil
+	}
+	lease := *s.lease
+	return &lease, nil
+}
+
+func (s *memoryLeaderStorage) ReleaseLeaderLock(_ context.Context, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lease = nil
+	return nil
+}
+
+func (s *memoryLeaderStorage) RenewLeaderLock(_ context.Context, _ string, holder string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail || s.lease == nil || s.lease.Holder != holder {
+		return errors.New("connection lost")
+	}
+	s.lease.RenewedAt = time.Now()
+	s.lease.ExpiresAt = time.Now().Add(ttl)
+	return nil
+}
+
+func (s *memoryLeaderStorage) TryLeaderLock(_ context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return false, errors.New("connection lost")
+	}
+	now := time.Now()
+	if s.lease != nil && (s.lease.Holder == holder || now.Before(s.lease.ExpiresAt)) {
+		return s.lease.Holder == holder, nil
+	}
+	s.lease = &models.LeaderLease{Name: name, Holder: holder, AcquiredAt: now, RenewedAt: now, ExpiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (s *memoryLeaderStorage) setFailing(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = fail
+}
+
+func TestLeaderElector(t *testing.T) {
+	storage := &memoryLeaderStorage{}
+	var running atomic.Int32
+	var runs atomic.Int32
+	job := func(ctx context.Context) {
+		runs.Add(1)
+		assert.Equal(t, int32(1), running.Add(1), "the job must run on one instance only")
+		<-ctx.Done()
+		running.Add(-1)
+	}
+
+	ctx := context.Background()
+	first := NewLeaderElector(storage, "jobs", "first", 30*time.Millisecond)
+	first.Register("job", job)
+	first.Start(ctx)
+	require.Eventually(t, first.IsLeader, time.Second, 5*time.Millisecond)
+
+	second := NewLeaderElector(storage, "jobs", "second", 30*time.Millisecond)
+	second.Register("job", job)
+	second.Start(ctx)
+	defer second.Stop(ctx)
+
+	details, err := second.CheckLeader(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "first", details["leader"])
+	assert.Equal(t, false, details["is_leader"])
+
+	// the stopped leader steps down and the other instance takes over
+	require.NoError(t, first.Stop(ctx))
+	assert.False(t, first.IsLeader())
+	require.Eventually(t, second.IsLeader, time.Second, 5*time.Millisecond)
+	assert.Eventually(t, func() bool { return running.Load() == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(2), runs.Load())
+}
+
+func TestLeaderElectorFailedRenewal(t *testing.T) {
+	storage := &memoryLeaderStorage{}
+	var running atomic.Bool
+	elector := NewLeaderElector(storage, "jobs", "first", 30*time.Millisecond)
+	elector.Register("job", func(ctx context.Context) {
+		running.Store(true)
+		<-ctx.Done()
+		running.Store(false)
+	})
+
+	ctx := context.Background()
+	elector.Start(ctx)
+	defer elector.Stop(ctx)
+	require.Eventually(t, running.Load, time.Second, 5*time.Millisecond)
+
+	// a leader that cannot renew its lease stops its jobs and campaigns again
+	storage.setFailing(true)
+	require.Eventually(t, func() bool { return !running.Load() }, time.Second, 5*time.Millisecond)
+	storage.setFailing(false)
+	assert.Eventually(t, running.Load, time.Second, 5*time.Millisecond)
+}
+
+func TestLeaderElectorWaitsForLease(t *testing.T) {
+	// a leader that lost its connection left a lease that has not expired
+	expiresAt := time.Now().Add(100 * time.Millisecond)
+	storage := &memoryLeaderStorage{lease: &models.LeaderLease{Name: "jobs", Holder: "first", ExpiresAt: expiresAt}}
+	var started atomic.Int64
+	elector := NewLeaderElector(storage, "jobs", "second", 30*time.Millisecond)
+	elector.Register("job", func(ctx context.Context) {
+		started.Store(time.Now().UnixNano())
+		<-ctx.Done()
+	})
+
+	ctx := context.Background()
+	elector.Start(ctx)
+	defer elector.Stop(ctx)
+	require.Eventually(t, elector.IsLeader, time.Second, 5*time.Millisecond)
+	require.Eventually(t, func() bool { return started.Load() != 0 }, time.Second, 5*time.Millisecond)
+	assert.False(t, time.Unix(0, started.Load()).Before(expiresAt), "the jobs start only after the previous lease expired")
+}
@@ -2,64 +2,117 @@ package services
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
-	"net/http"
-	"strconv"
+	"sync"
 	"time"
 
-	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/evgfitil/gophermart.git/internal/accrual"
 	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/metrics"
 	"github.com/evgfitil/gophermart.git/internal/models"
 )
 
 const (
-	defaultRetrySeconds = 1
+	accrualMaxAttempts       = 4
+	accrualBaseRetryDelay    = 500 * time.Millisecond
+	accrualMaxRetryDelay     = 30 * time.Second
+	accrualFailureThreshold  = 5
+	accrualCircuitCooldown   = 30 * time.Second
+	accrualQuarantinePeriod  = time.Hour
+	uploadedOrdersBufferSize = 256
+	orderBatchSize           = 100
+	orderMaxAttempts         = 20
+	orderBaseRetryDelay      = 30 * time.Second
+	orderMaxRetryDelay       = 6 * time.Hour
+	orderUpdateTimeout       = 5 * time.Second
+	tracerName               = "github.com/evgfitil/gophermart.git/internal/services"
 )
 
-type accrualResponse struct {
-	Order   string  `json:"order"`
-	Status  string  `json:"status"`
-	Accrual float64 `json:"accrual,omitempty"`
+// backlogStatuses are the order statuses reported by the backlog gauge, so
+// that a status drops to zero once its last order leaves it
+var backlogStatuses = []string{models.OrderStatusNew, models.OrderStatusProcessing}
+
+var errCircuitOpen = errors.New("accrual circuit breaker is open")
+
+// AccrualClient queries the accrual system. GetOrder reports the outcome
+// with the typed errors of the accrual package.
+type AccrualClient interface {
+	GetOrder(ctx context.Context, number string) (*accrual.Order, error)
+	Ping(ctx context.Context) (int, error)
+}
+
+// NewOrderListener announces uploaded orders.
+type NewOrderListener interface {
+	ListenNewOrders(ctx context.Context, handle func(orderNumber string)) error
 }
 
 type OrderStorage interface {
-	GetNewOrders(ctx context.Context) ([]models.Order, error)
+	CountOrdersByStatus(ctx context.Context) (map[string]int, error)
+	DeadLetterOrder(ctx context.Context, orderNumber string, lastError string) error
+	DeferOrder(ctx context.Context, orderNumber string, nextCheckAt time.Time, lastError string) error
+	GetNewOrders(ctx context.Context, limit int) ([]models.Order, error)
 	GetOrders(ctx context.Context, userID int) ([]models.Order, error)
 	ProcessOrder(ctx context.Context, order models.Order) error
+	RecheckOrderAccrual(ctx context.Context, orderNumber string, accrual float64) (*models.AccrualRecheck, error)
+	RescheduleOrder(ctx context.Context, orderNumber string, nextCheckAt time.Time, lastError string) error
 	UpdateOrderAccrual(ctx context.Context, orderNumber string, accrual float64) error
 	UpdateOrderStatus(ctx context.Context, orderNumber string, status string) error
 }
 
 type LoyaltyProcessorService struct {
-	AccrualURL   string
-	OrderStorage OrderStorage
-	client       *resty.Client
+	worker
+	AccrualClient AccrualClient
+	OrderStorage  OrderStorage
+	retry         retryPolicy
+	orderRetry    retryPolicy
+	breaker       *circuitBreaker
+	quarantine    *quarantine
+	listener      NewOrderListener
+	// checking serializes the checks of polled and uploaded orders, so that
+	// an order is never checked twice at the same time
+	checking sync.Mutex
 }
 
-func NewLoyaltyProcessorService(URL string, os OrderStorage) *LoyaltyProcessorService {
-	client := resty.New()
+// NewLoyaltyProcessorService returns a processor that checks the orders of
+// os with client. Without a listener uploaded orders wait for the next
+// sweep.
+func NewLoyaltyProcessorService(client AccrualClient, os OrderStorage, l NewOrderListener) *LoyaltyProcessorService {
 	return &LoyaltyProcessorService{
-		AccrualURL:   URL,
-		OrderStorage: os,
-		client:       client,
+		AccrualClient: client,
+		OrderStorage:  os,
+		listener:      l,
+		retry: retryPolicy{
+			maxAttempts: accrualMaxAttempts,
+			baseDelay:   accrualBaseRetryDelay,
+			maxDelay:    accrualMaxRetryDelay,
+		},
+		orderRetry: retryPolicy{
+			maxAttempts: orderMaxAttempts,
+			baseDelay:   orderBaseRetryDelay,
+			maxDelay:    orderMaxRetryDelay,
+		},
+		breaker:    newCircuitBreaker(accrualFailureThreshold, accrualCircuitCooldown),
+		quarantine: newQuarantine(accrualQuarantinePeriod),
 	}
 }
 
 func (lps *LoyaltyProcessorService) updateOrder(ctx context.Context, order models.Order) error {
 	switch order.Status {
-	case "PROCESSED":
-		fmt.Println("PROCESSED")
+	case models.OrderStatusProcessed:
 		if err := lps.OrderStorage.UpdateOrderAccrual(ctx, order.OrderNumber, order.Accrual); err != nil {
-			logger.Sugar.Errorf("OrderNumber: %v, OrderAccrual: %v", order.OrderNumber, order.Accrual)
-			logger.Sugar.Errorln("update order accrual failed", err)
+			logger.FromContext(ctx).Errorf("OrderNumber: %v, OrderAccrual: %v", order.OrderNumber, order.Accrual)
+			logger.FromContext(ctx).Errorln("update order accrual failed", err)
 			return err
 		}
+		metrics.ProcessorAccrualsTotal.Inc()
+		metrics.ProcessorAccruedPointsTotal.Add(order.Accrual)
 	default:
 		if err := lps.OrderStorage.UpdateOrderStatus(ctx, order.OrderNumber, order.Status); err != nil {
-			logger.Sugar.Errorln("update order status failed", err)
+			logger.FromContext(ctx).Errorln("update order status failed", err)
 			return err
 		}
 	}
@@ -67,77 +120,304 @@ func (lps *LoyaltyProcessorService) updateOrder(ctx context.Context, order model
 }
 
 func (lps *LoyaltyProcessorService) CheckAccrual(ctx context.Context, orders []models.Order) {
-	for _, order := range orders {
-		retryCount := 0
-		resp, err := lps.client.R().
-			SetContext(ctx).
-			SetHeader("Content-Type", "application/json").
-			Get(lps.AccrualURL + "/api/orders/" + order.OrderNumber)
-		if err != nil {
-			logger.Sugar.Errorln("Error making request to accrual service: ", err)
-			continue
+	for i, order := range orders {
+		if ctx.Err() != nil {
+			return
 		}
-
-		if resp.StatusCode() == http.StatusNoContent {
-			logger.Sugar.Infof("Order %s is not registered in accrual service", order.OrderNumber)
-			continue
+		if state, _, _ := lps.breaker.State(); state == circuitOpen {
+			logger.FromContext(ctx).Warnf("accrual circuit breaker is open, skipping %d orders", len(orders)-i)
+			return
 		}
+		lps.checkOrder(ctx, order)
+	}
+}
 
-		if resp.StatusCode() == http.StatusTooManyRequests {
-			retryAfter := resp.Header().Get("Retry-After")
-			var retrySeconds int
-			retrySeconds, err = strconv.Atoi(retryAfter)
-			if err != nil {
-				logger.Sugar.Errorln("Error converting Retry-After header to int: ", err)
-				retrySeconds = defaultRetrySeconds
-			}
-			time.Sleep(time.Duration(retrySeconds) * time.Second)
-		}
+func (lps *LoyaltyProcessorService) checkOrder(ctx context.Context, order models.Order) {
+	lps.checking.Lock()
+	defer lps.checking.Unlock()
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "LoyaltyProcessorService.checkOrder")
+	span.SetAttributes(attribute.String("order.number", order.OrderNumber))
+	defer span.End()
+	// everything logged for this order, including by the storage, carries
+	// the order number
+	ctx = logger.WithContext(ctx, logger.FromContext(ctx).With("order", order.OrderNumber))
+
+	if lps.quarantine.Contains(order.OrderNumber) {
+		logger.FromContext(ctx).Debugf("Order %s is quarantined", order.OrderNumber)
+		return
+	}
+
+	result, err := lps.getOrder(ctx, order.OrderNumber)
+	switch {
+	case err == nil:
+	case errors.Is(err, accrual.ErrNotRegistered):
+		logger.FromContext(ctx).Infof("Order %s is not registered in accrual service", order.OrderNumber)
+		lps.retryLater(ctx, order, lps.orderRetry.delay(order.Attempts+1), err.Error())
+		return
+	case errors.Is(err, accrual.ErrMalformedResponse):
+		lps.quarantineOrder(ctx, order, &accrualAnomaly{reason: "malformed_response", detail: err.Error()})
+		return
+	case errors.Is(err, errCircuitOpen), ctx.Err() != nil:
+		// not the order's fault, it stays due
+		logger.FromContext(ctx).Warnln("Error getting order from accrual service: ", err)
+		return
+	default:
+		// the accrual system is failing or busy, which does not count
+		// against the order
+		logger.FromContext(ctx).Errorln("Error getting order from accrual service: ", err)
+		lps.deferOrder(ctx, order, lps.orderRetry.baseDelay, err.Error())
+		return
+	}
+
+	status, anomaly := validateAccrual(order.OrderNumber, result)
+	if anomaly != nil {
+		lps.quarantineOrder(ctx, order, anomaly)
+		return
+	}
+	logger.FromContext(ctx).Debugln("Processed order ", order.OrderNumber, " with status ", result.Status)
+
+	// only orders marked for a recheck are processed already
+	if order.Status == models.OrderStatusProcessed {
+		lps.recheckOrder(ctx, order, status, result.Accrual)
+		return
+	}
+
+	order.Status = status
+	order.Accrual = result.Accrual
+
+	// once the accrual service has answered, the update is completed
+	// even if the processor is being stopped
+	updateCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), orderUpdateTimeout)
+	err = lps.updateOrder(updateCtx, order)
+	cancel()
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error updating order %s with status %s", order.OrderNumber, status)
+	}
+}
 
-		if resp.StatusCode() == http.StatusInternalServerError {
-			delay := time.Duration(math.Pow(2, float64(retryCount))) * time.Second
-			logger.Sugar.Errorf("internal server error: error making request to accrual service, retrying in %v", delay)
-			time.Sleep(delay)
-			retryCount++
+// recheckOrder applies the answer of the accrual system to a processed order
+// marked for a recheck. The order is retried until the accrual system
+// reports it processed again.
+func (lps *LoyaltyProcessorService) recheckOrder(ctx context.Context, order models.Order, status string, accrual float64) {
+	if status != models.OrderStatusProcessed {
+		lps.retryLater(ctx, order, lps.orderRetry.delay(order.Attempts+1),
+			fmt.Sprintf("accrual system reports %s for a processed order", status))
+		return
+	}
+
+	updateCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), orderUpdateTimeout)
+	defer cancel()
+	recheck, err := lps.OrderStorage.RecheckOrderAccrual(updateCtx, order.OrderNumber, accrual)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("error rechecking order %s: %v", order.OrderNumber, err)
+		return
+	}
+	switch {
+	case recheck.Corrected:
+		metrics.ProcessorAccrualCorrectionsTotal.WithLabelValues("corrected").Inc()
+		logger.FromContext(ctx).Warnw("order accrual corrected", "previous", recheck.Previous, "accrual", recheck.Accrual)
+	case recheck.Refused:
+		metrics.ProcessorAccrualCorrectionsTotal.WithLabelValues("refused").Inc()
+		logger.FromContext(ctx).Errorw("order accrual correction refused, the balance is too low", "previous", recheck.Previous, "accrual", recheck.Accrual)
+	case recheck.Changed:
+		metrics.ProcessorAccrualCorrectionsTotal.WithLabelValues("skipped").Inc()
+		logger.FromContext(ctx).Warnw("order accrual changed, not corrected", "previous", recheck.Previous, "accrual", recheck.Accrual)
+	}
+}
+
+// quarantineOrder keeps the order from being updated or requested again for
+// accrualQuarantinePeriod.
+func (lps *LoyaltyProcessorService) quarantineOrder(ctx context.Context, order models.Order, anomaly *accrualAnomaly) {
+	lps.quarantine.Add(order.OrderNumber)
+	metrics.AccrualAnomaliesTotal.WithLabelValues(anomaly.reason).Inc()
+	logger.FromContext(ctx).Errorw("order quarantined",
+		"reason", anomaly.reason,
+		"detail", anomaly.detail,
+		"until", time.Now().Add(accrualQuarantinePeriod).Format(time.RFC3339),
+	)
+	lps.retryLater(ctx, order, accrualQuarantinePeriod, anomaly.Error())
+}
+
+// retryLater records a failed check and schedules the next one after delay.
+// An order that has used up its attempts is moved to the dead letter
+// instead, where it waits to be requeued by an admin.
+func (lps *LoyaltyProcessorService) retryLater(ctx context.Context, order models.Order, delay time.Duration, lastError string) {
+	updateCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), orderUpdateTimeout)
+	defer cancel()
+
+	attempts := order.Attempts + 1
+	if attempts >= lps.orderRetry.maxAttempts {
+		if err := lps.OrderStorage.DeadLetterOrder(updateCtx, order.OrderNumber, lastError); err != nil {
+			logger.FromContext(ctx).Errorf("error dead-lettering order %s: %v", order.OrderNumber, err)
+			return
 		}
+		metrics.ProcessorDeadLettersTotal.Inc()
+		logger.FromContext(ctx).Warnw("order moved to the dead letter", "attempts", attempts, "last_error", lastError)
+		return
+	}
+
+	if err := lps.OrderStorage.RescheduleOrder(updateCtx, order.OrderNumber, time.Now().Add(delay), lastError); err != nil {
+		logger.FromContext(ctx).Errorf("error rescheduling order %s: %v", order.OrderNumber, err)
+	}
+}
 
-		var result accrualResponse
-		err = json.Unmarshal(resp.Body(), &result)
-		if err != nil {
-			logger.Sugar.Errorln("Error unmarshalling response from accrual service: ", err)
+// deferOrder schedules the next check of the order after delay without using
+// up one of its attempts.
+func (lps *LoyaltyProcessorService) deferOrder(ctx context.Context, order models.Order, delay time.Duration, lastError string) {
+	updateCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), orderUpdateTimeout)
+	defer cancel()
+	if err := lps.OrderStorage.DeferOrder(updateCtx, order.OrderNumber, time.Now().Add(delay), lastError); err != nil {
+		logger.FromContext(ctx).Errorf("error deferring order %s: %v", order.OrderNumber, err)
+	}
+}
+
+// getOrder requests the order from the accrual service. Rate limited
+// requests are retried after Retry-After, failed ones with capped
+// exponential backoff, and the circuit breaker stops requests to a service
+// that keeps failing.
+func (lps *LoyaltyProcessorService) getOrder(ctx context.Context, number string) (*accrual.Order, error) {
+	for attempt := 1; ; attempt++ {
+		if !lps.breaker.Allow() {
+			return nil, errCircuitOpen
 		}
-		logger.Sugar.Debugln("Processed order ", order.OrderNumber, " with status ", result.Status)
 
-		order.Status = result.Status
-		order.Accrual = result.Accrual
+		result, err := lps.AccrualClient.GetOrder(ctx, number)
+		var rateLimitErr *accrual.RateLimitError
+		var delay time.Duration
+		switch {
+		case err == nil, errors.Is(err, accrual.ErrNotRegistered), errors.Is(err, accrual.ErrMalformedResponse):
+			lps.breaker.Success()
+			return result, err
+		case errors.As(err, &rateLimitErr):
+			// the service is up, just busy
+			lps.breaker.Success()
+			delay = rateLimitErr.RetryAfter
+		case ctx.Err() != nil:
+			lps.breaker.Release()
+			return nil, err
+		default:
+			lps.breaker.Failure()
+			delay = lps.retry.delay(attempt)
+		}
 
-		if err = lps.updateOrder(ctx, order); err != nil {
-			logger.Sugar.Errorf("error updating order %s with status %s", order.OrderNumber, result.Status)
+		if attempt >= lps.retry.maxAttempts {
+			return nil, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+		logger.FromContext(ctx).Warnf("%v, retrying in %v", err, delay)
+		metrics.AccrualRetryAfterSeconds.Observe(delay.Seconds())
+		if err = sleep(ctx, delay); err != nil {
+			return nil, err
 		}
 	}
 }
 
-func (lps *LoyaltyProcessorService) Start(ctx context.Context, interval time.Duration) {
-	logger.Sugar.Infoln("Starting loyaltyProcessorService")
+// Start checks uploaded orders in the background until Stop.
+func (lps *LoyaltyProcessorService) Start(ctx context.Context) {
+	lps.start(ctx, lps.ListenUploaded)
+}
+
+// ListenUploaded checks uploaded orders as soon as the listener announces
+// them until ctx is cancelled. Without a listener it only waits for ctx.
+func (lps *LoyaltyProcessorService) ListenUploaded(ctx context.Context) {
+	if lps.listener == nil {
+		<-ctx.Done()
+		return
+	}
+	logger.Sugar.Infoln("Listening for uploaded orders")
+
+	uploaded := make(chan string, uploadedOrdersBufferSize)
+	var wg sync.WaitGroup
+	wg.Add(1)
 	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
+		defer wg.Done()
+		lps.listen(ctx, uploaded)
+	}()
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case orderNumber := <-uploaded:
+			lps.checkOrder(ctx, models.Order{OrderNumber: orderNumber, Status: models.OrderStatusNew})
+		}
+	}
+}
 
-		for {
+// listen passes announced orders to uploaded, reconnecting the listener
+// until ctx is cancelled. Orders that do not fit in uploaded are left to the
+// next poll.
+func (lps *LoyaltyProcessorService) listen(ctx context.Context, uploaded chan<- string) {
+	for {
+		err := lps.listener.ListenNewOrders(ctx, func(orderNumber string) {
 			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				orders, err := lps.OrderStorage.GetNewOrders(ctx)
-				if err != nil {
-					logger.Sugar.Errorln("Error fetching new orders: ", err)
-					continue
-				}
-				if len(orders) == 0 {
-					continue
-				}
-				lps.CheckAccrual(ctx, orders)
+			case uploaded <- orderNumber:
+			default:
+				logger.Sugar.Warnf("processor is busy, order %s is left to polling", orderNumber)
 			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logger.Sugar.Errorf("new orders listener stopped, reconnecting in %v: %v", listenerReconnectDelay, err)
+		}
+
+		if sleep(ctx, listenerReconnectDelay) != nil {
+			return
 		}
+	}
+}
+
+// Poll sweeps the unfinished orders that are due. It is run by the job
+// scheduler and fails only if the orders cannot be fetched, the outcome of
+// every order is recorded on the order itself.
+func (lps *LoyaltyProcessorService) Poll(ctx context.Context) error {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "LoyaltyProcessorService.Poll")
+	start := time.Now()
+	defer func() {
+		span.End()
+		metrics.ProcessorRunDuration.Observe(time.Since(start).Seconds())
 	}()
+	lps.updateBacklog(ctx)
+
+	orders, err := lps.OrderStorage.GetNewOrders(ctx, orderBatchSize)
+	if err != nil {
+		return fmt.Errorf("error fetching new orders: %w", err)
+	}
+	lps.CheckAccrual(ctx, orders)
+	return nil
+}
+
+func (lps *LoyaltyProcessorService) updateBacklog(ctx context.Context) {
+	counts, err := lps.OrderStorage.CountOrdersByStatus(ctx)
+	if err != nil {
+		logger.Sugar.Errorln("Error counting orders: ", err)
+		return
+	}
+	for _, status := range backlogStatuses {
+		metrics.OrderBacklog.WithLabelValues(status).Set(float64(counts[status]))
+	}
+}
+
+// CheckAccrualService reports whether the accrual service answers HTTP
+// requests at all, whatever the status code.
+func (lps *LoyaltyProcessorService) CheckAccrualService(ctx context.Context) (map[string]any, error) {
+	statusCode, err := lps.AccrualClient.Ping(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"status_code": statusCode}, nil
+}
+
+// CheckCircuitBreaker reports the state of the accrual circuit breaker and
+// fails while it is open.
+func (lps *LoyaltyProcessorService) CheckCircuitBreaker(_ context.Context) (map[string]any, error) {
+	state, failures, openedAt := lps.breaker.State()
+	details := map[string]any{"state": state.String(), "consecutive_failures": failures}
+	if state == circuitOpen {
+		details["opened_at"] = openedAt.Format(time.RFC3339)
+		return details, errCircuitOpen
+	}
+	return details, nil
 }
@@ -0,0 +1,440 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/evgfitil/gophermart.git/internal/accrual"
+	"github.com/evgfitil/gophermart.git/internal/accrualmock"
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+// memoryOrderStorage keeps orders by number for tests against the accrual
+// mock.
+type memoryOrderStorage struct {
+	mu     sync.Mutex
+	orders map[string]models.Order
+	due    map[string]time.Time
+	dead   map[string]string
+	// recheck holds processed orders marked for a recheck, true with
+	// corrections
+	recheck     map[string]bool
+	corrections map[string]float64
+	// balances of the owners of orders, which corrections must not take
+	// below zero; a missing one is the accrual of the order
+	balances map[string]float64
+}
+
+func newMemoryOrderStorage(orders ...models.Order) *memoryOrderStorage {
+	s := &memoryOrderStorage{
+		orders: make(map[string]models.Order),
+		due:    make(map[string]time.Time),
+		dead:   make(map[string]string),
+
+		recheck:     make(map[string]bool),
+		corrections: make(map[string]float64),
+		balances:    make(map[string]float64),
+	}
+	for _, order := range orders {
+		s.orders[order.OrderNumber] = order
+	}
+	return s
+}
+
+func (s *memoryOrderStorage) order(number string) models.Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.orders[number]
+}
+
+func (s *memoryOrderStorage) CountOrdersByStatus(_ context.Context) (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]int)
+	for _, order := range s.orders {
+		counts[order.Status]++
+	}
+	return counts, nil
+}
+
+func (s *memoryOrderStorage) DeadLetterOrder(_ context.Context, orderNumber string, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order := s.orders[orderNumber]
+	order.Attempts++
+	s.orders[orderNumber] = order
+	s.dead[orderNumber] = lastError
+	return nil
+}
+
+func (s *memoryOrderStorage) DeferOrder(_ context.Context, orderNumber string, nextCheckAt time.Time, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.due[orderNumber] = nextCheckAt
+	return nil
+}
+
+func (s *memoryOrderStorage) GetNewOrders(_ context.Context, limit int) ([]models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var orders []models.Order
+	for number, order := range s.orders {
+		if (order.Status == "PROCESSED" && !s.isRechecked(number)) || order.Status == "INVALID" {
+			continue
+		}
+		if _, ok := s.dead[number]; ok || time.Now().Before(s.due[number]) {
+			continue
+		}
+		if len(orders) == limit {
+			break
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+func (s *memoryOrderStorage) GetOrders(_ context.Context, userID int) ([]models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var orders []models.Order
+	for _, order := range s.orders {
+		if order.UserID == userID {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func (s *memoryOrderStorage) ProcessOrder(_ context.Context, order models.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orders[order.OrderNumber] = order
+	return nil
+}
+
+func (s *memoryOrderStorage) isRechecked(number string) bool {
+	_, ok := s.recheck[number]
+	return ok
+}
+
+func (s *memoryOrderStorage) RecheckOrderAccrual(_ context.Context, orderNumber string, accrual float64) (*models.AccrualRecheck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	correct, ok := s.recheck[orderNumber]
+	if !ok {
+		return nil, apperrors.ErrOrderNotFound
+	}
+	delete(s.recheck, orderNumber)
+
+	order := s.orders[orderNumber]
+	recheck := &models.AccrualRecheck{Previous: order.Accrual, Accrual: accrual, Changed: order.Accrual != accrual}
+	balance, ok := s.balances[orderNumber]
+	if !ok {
+		balance = order.Accrual
+	}
+	if recheck.Changed && correct && balance+accrual-order.Accrual < 0 {
+		recheck.Refused = true
+		return recheck, nil
+	}
+	if recheck.Changed && correct {
+		s.corrections[orderNumber] += accrual - order.Accrual
+		order.Accrual = accrual
+		s.orders[orderNumber] = order
+		recheck.Corrected = true
+	}
+	return recheck, nil
+}
+
+func (s *memoryOrderStorage) RescheduleOrder(_ context.Context, orderNumber string, nextCheckAt time.Time, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order := s.orders[orderNumber]
+	order.Attempts++
+	s.orders[orderNumber] = order
+	s.due[orderNumber] = nextCheckAt
+	return nil
+}
+
+func (s *memoryOrderStorage) UpdateOrderAccrual(_ context.Context, orderNumber string, accrual float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order := s.orders[orderNumber]
+	order.Status = "PROCESSED"
+	order.Accrual = accrual
+	s.orders[orderNumber] = order
+	return nil
+}
+
+func (s *memoryOrderStorage) UpdateOrderStatus(_ context.Context, orderNumber string, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order := s.orders[orderNumber]
+	order.Status = status
+	s.orders[orderNumber] = order
+	return nil
+}
+
+func TestLoyaltyProcessorWithAccrualMock(t *testing.T) {
+	mock := accrualmock.New(accrualmock.Config{
+		Rules:        []accrualmock.Rule{{Prefix: "2", Invalid: true}, {Prefix: "1", Accrual: 500}},
+		PendingPolls: 1,
+	})
+	ts := mock.Start()
+	defer ts.Close()
+
+	storage := newMemoryOrderStorage(
+		models.Order{OrderNumber: "12345678903", Status: "NEW"},
+		models.Order{OrderNumber: "2377225624", Status: "NEW"},
+		models.Order{OrderNumber: "49927398716", Status: "NEW"},
+	)
+	client, err := accrual.NewHTTPClient(ts.URL, accrual.Config{})
+	require.NoError(t, err)
+	lps := NewLoyaltyProcessorService(client, storage, nil)
+	ctx := context.Background()
+
+	require.NoError(t, lps.Poll(ctx))
+	// REGISTERED in the accrual system is PROCESSING for gophermart
+	assert.Equal(t, "PROCESSING", storage.order("12345678903").Status)
+	assert.Equal(t, "PROCESSING", storage.order("2377225624").Status)
+
+	require.NoError(t, lps.Poll(ctx))
+
+	processed := storage.order("12345678903")
+	assert.Equal(t, "PROCESSED", processed.Status)
+	assert.Equal(t, 500.0, processed.Accrual)
+	assert.Equal(t, "INVALID", storage.order("2377225624").Status)
+	// orders the accrual system does not know are left as they are
+	assert.Equal(t, "NEW", storage.order("49927398716").Status)
+	assert.Equal(t, 2, mock.Polls("12345678903"))
+}
+
+// stubAccrualClient fails with errs in turn and then answers every order
+// with order.
+type stubAccrualClient struct {
+	order *accrual.Order
+	errs  []error
+	calls int
+}
+
+func (c *stubAccrualClient) GetOrder(_ context.Context, number string) (*accrual.Order, error) {
+	c.calls++
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return nil, err
+	}
+	order := *c.order
+	order.Number = number
+	return &order, nil
+}
+
+func (c *stubAccrualClient) Ping(_ context.Context) (int, error) {
+	return 200, nil
+}
+
+func TestLoyaltyProcessorCheckOrder(t *testing.T) {
+	processed := &accrual.Order{Status: "PROCESSED", Accrual: 729.98}
+	serverErr := fmt.Errorf("%w: status 500", accrual.ErrServer)
+
+	tests := []struct {
+		name        string
+		client      *stubAccrualClient
+		wantStatus  string
+		maxAttempts int
+		wantAccrual float64
+		wantCalls   int
+	}{
+		{
+			name:        "processed",
+			client:      &stubAccrualClient{order: processed},
+			wantStatus:  "PROCESSED",
+			wantAccrual: 729.98,
+			wantCalls:   1,
+		},
+		{
+			name:       "not registered",
+			client:     &stubAccrualClient{errs: []error{accrual.ErrNotRegistered}, order: processed},
+			wantStatus: "NEW",
+			wantCalls:  1,
+		},
+		{
+			name:       "malformed response",
+			client:     &stubAccrualClient{errs: []error{accrual.ErrMalformedResponse}, order: processed},
+			wantStatus: "NEW",
+			wantCalls:  1,
+		},
+		{
+			name: "retried after rate limit and server errors",
+			client: &stubAccrualClient{
+				errs:  []error{&accrual.RateLimitError{RetryAfter: time.Millisecond}, serverErr, errors.New("connection refused")},
+				order: processed,
+			},
+			wantStatus:  "PROCESSED",
+			wantAccrual: 729.98,
+			wantCalls:   4,
+		},
+		{
+			name:        "gives up after max attempts",
+			client:      &stubAccrualClient{errs: []error{serverErr, serverErr, serverErr, serverErr}, order: processed},
+			maxAttempts: 3,
+			wantStatus:  "NEW",
+			wantCalls:   3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := models.Order{OrderNumber: "12345678903", Status: "NEW"}
+			storage := newMemoryOrderStorage(order)
+			lps := NewLoyaltyProcessorService(tt.client, storage, nil)
+			lps.retry = retryPolicy{maxAttempts: 4, baseDelay: time.Millisecond, maxDelay: 5 * time.Millisecond}
+			if tt.maxAttempts != 0 {
+				lps.retry.maxAttempts = tt.maxAttempts
+			}
+
+			lps.CheckAccrual(context.Background(), []models.Order{order})
+
+			got := storage.order(order.OrderNumber)
+			assert.Equal(t, tt.wantStatus, got.Status)
+			assert.Equal(t, tt.wantAccrual, got.Accrual)
+			assert.Equal(t, tt.wantCalls, tt.client.calls)
+		})
+	}
+}
+
+func TestLoyaltyProcessorCircuitBreaker(t *testing.T) {
+	serverErr := fmt.Errorf("%w: status 500", accrual.ErrServer)
+	client := &stubAccrualClient{
+		errs:  []error{serverErr, serverErr, serverErr, serverErr},
+		order: &accrual.Order{Status: "PROCESSED", Accrual: 100},
+	}
+	orders := []models.Order{
+		{OrderNumber: "12345678903", Status: "NEW"},
+		{OrderNumber: "2377225624", Status: "NEW"},
+	}
+	storage := newMemoryOrderStorage(orders...)
+	lps := NewLoyaltyProcessorService(client, storage, nil)
+	lps.retry = retryPolicy{maxAttempts: 2, baseDelay: time.Millisecond, maxDelay: time.Millisecond}
+	lps.breaker = newCircuitBreaker(4, time.Hour)
+	now := time.Now()
+	lps.breaker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// two orders with two failed attempts each open the circuit
+	lps.CheckAccrual(ctx, orders)
+	assert.Equal(t, 4, client.calls)
+
+	details, err := lps.CheckCircuitBreaker(ctx)
+	assert.ErrorIs(t, err, errCircuitOpen)
+	assert.Equal(t, "open", details["state"])
+
+	// while the circuit is open the accrual service is not called
+	lps.CheckAccrual(ctx, orders)
+	assert.Equal(t, 4, client.calls)
+	assert.Equal(t, "NEW", storage.order("12345678903").Status)
+
+	// after the cooldown a successful probe closes the circuit again
+	now = now.Add(time.Hour)
+	lps.CheckAccrual(ctx, orders)
+	assert.Equal(t, 6, client.calls)
+	assert.Equal(t, "PROCESSED", storage.order("12345678903").Status)
+	assert.Equal(t, "PROCESSED", storage.order("2377225624").Status)
+
+	details, err = lps.CheckCircuitBreaker(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "closed", details["state"])
+}
+
+func TestLoyaltyProcessorDeadLetter(t *testing.T) {
+	serverErr := fmt.Errorf("%w: status 500", accrual.ErrServer)
+	client := &stubAccrualClient{
+		errs:  []error{serverErr, accrual.ErrNotRegistered, serverErr, accrual.ErrNotRegistered, accrual.ErrNotRegistered},
+		order: &accrual.Order{Status: "PROCESSED", Accrual: 100},
+	}
+	storage := newMemoryOrderStorage(models.Order{OrderNumber: "12345678903", Status: "NEW"})
+	lps := NewLoyaltyProcessorService(client, storage, nil)
+	lps.retry = retryPolicy{maxAttempts: 1}
+	lps.orderRetry = retryPolicy{maxAttempts: 3, baseDelay: time.Hour, maxDelay: time.Hour}
+	ctx := context.Background()
+
+	orders, err := storage.GetNewOrders(ctx, orderBatchSize)
+	require.NoError(t, err)
+	lps.CheckAccrual(ctx, orders)
+
+	// an order is not due again until its backoff has passed, and a failing
+	// accrual system does not use up its attempts
+	orders, err = storage.GetNewOrders(ctx, orderBatchSize)
+	require.NoError(t, err)
+	assert.Empty(t, orders)
+	assert.Equal(t, 0, storage.order("12345678903").Attempts)
+
+	for _, wantAttempts := range []int{1, 1, 2} {
+		lps.CheckAccrual(ctx, []models.Order{storage.order("12345678903")})
+		assert.Equal(t, wantAttempts, storage.order("12345678903").Attempts)
+		assert.Empty(t, storage.dead)
+	}
+
+	lps.CheckAccrual(ctx, []models.Order{storage.order("12345678903")})
+	assert.Contains(t, storage.dead["12345678903"], accrual.ErrNotRegistered.Error())
+	assert.Equal(t, "NEW", storage.order("12345678903").Status)
+}
+
+func TestLoyaltyProcessorRecheck(t *testing.T) {
+	client := &stubAccrualClient{order: &accrual.Order{Status: "PROCESSED", Accrual: 150}}
+	storage := newMemoryOrderStorage(
+		models.Order{OrderNumber: "12345678903", Status: "PROCESSED", Accrual: 100},
+		models.Order{OrderNumber: "2377225624", Status: "PROCESSED", Accrual: 100},
+		models.Order{OrderNumber: "49927398716", Status: "PROCESSED", Accrual: 100},
+	)
+	storage.recheck["12345678903"] = true
+	storage.recheck["2377225624"] = false
+	lps := NewLoyaltyProcessorService(client, storage, nil)
+	ctx := context.Background()
+
+	orders, err := storage.GetNewOrders(ctx, orderBatchSize)
+	require.NoError(t, err)
+	assert.Len(t, orders, 2, "processed orders without a recheck are not due")
+	lps.CheckAccrual(ctx, orders)
+
+	assert.Equal(t, 150.0, storage.order("12345678903").Accrual)
+	assert.Equal(t, 50.0, storage.corrections["12345678903"])
+	// without corrections a changed accrual is only reported
+	assert.Equal(t, 100.0, storage.order("2377225624").Accrual)
+	assert.NotContains(t, storage.corrections, "2377225624")
+	assert.Empty(t, storage.recheck)
+
+	orders, err = storage.GetNewOrders(ctx, orderBatchSize)
+	require.NoError(t, err)
+	assert.Empty(t, orders)
+}
+
+func TestLoyaltyProcessorRecheckRefused(t *testing.T) {
+	client := &stubAccrualClient{order: &accrual.Order{Status: "PROCESSED", Accrual: 150}}
+	storage := newMemoryOrderStorage(
+		models.Order{OrderNumber: "12345678903", Status: "PROCESSED", Accrual: 200},
+		models.Order{OrderNumber: "2377225624", Status: "PROCESSED", Accrual: 200},
+	)
+	storage.recheck["12345678903"] = true
+	storage.recheck["2377225624"] = true
+	// most of the points of the first order are spent already
+	storage.balances["12345678903"] = 20
+	lps := NewLoyaltyProcessorService(client, storage, nil)
+	ctx := context.Background()
+
+	orders, err := storage.GetNewOrders(ctx, orderBatchSize)
+	require.NoError(t, err)
+	lps.CheckAccrual(ctx, orders)
+
+	assert.Equal(t, 200.0, storage.order("12345678903").Accrual, "a correction below a zero balance is refused")
+	assert.NotContains(t, storage.corrections, "12345678903")
+	assert.Equal(t, 150.0, storage.order("2377225624").Accrual)
+	assert.Equal(t, -50.0, storage.corrections["2377225624"])
+}
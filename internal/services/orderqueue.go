@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+// OrderQueue passes uploaded orders to the loyalty processor of the same
+// instance. It replaces Postgres notifications when a single instance runs.
+type OrderQueue struct {
+	orders chan string
+}
+
+func NewOrderQueue(size int) *OrderQueue {
+	return &OrderQueue{orders: make(chan string, size)}
+}
+
+// Push queues the order without blocking. When the queue is full the order
+// is left to the next polling run.
+func (q *OrderQueue) Push(orderNumber string) {
+	select {
+	case q.orders <- orderNumber:
+	default:
+		logger.Sugar.Warnf("order queue is full, order %s is left to polling", orderNumber)
+	}
+}
+
+// ListenNewOrders calls handle for every queued order until ctx is
+// cancelled.
+func (q *OrderQueue) ListenNewOrders(ctx context.Context, handle func(orderNumber string)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case orderNumber := <-q.orders:
+			handle(orderNumber)
+		}
+	}
+}
+
+// OrderStorage returns os with ProcessOrder pushing every stored order to
+// the queue.
+func (q *OrderQueue) OrderStorage(os OrderStorage) OrderStorage {
+	return &queueingOrderStorage{OrderStorage: os, queue: q}
+}
+
+type queueingOrderStorage struct {
+	OrderStorage
+	queue *OrderQueue
+}
+
+func (s *queueingOrderStorage) ProcessOrder(ctx context.Context, order models.Order) error {
+	if err := s.OrderStorage.ProcessOrder(ctx, order); err != nil {
+		return err
+	}
+	s.queue.Push(order.OrderNumber)
+	return nil
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/evgfitil/gophermart.git/internal/accrual"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+func TestOrderQueue(t *testing.T) {
+	queue := NewOrderQueue(1)
+	storage := queue.OrderStorage(newMemoryOrderStorage())
+	ctx, cancel := context.WithCancel(context.Background())
+
+	require.NoError(t, storage.ProcessOrder(ctx, models.Order{OrderNumber: "12345678903", Status: models.OrderStatusNew}))
+	// the queue is full, the order is left to polling
+	require.NoError(t, storage.ProcessOrder(ctx, models.Order{OrderNumber: "2377225624", Status: models.OrderStatusNew}))
+
+	var got []string
+	done := make(chan error)
+	go func() {
+		done <- queue.ListenNewOrders(ctx, func(orderNumber string) {
+			got = append(got, orderNumber)
+			cancel()
+		})
+	}()
+
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Equal(t, []string{"12345678903"}, got)
+}
+
+func TestLoyaltyProcessorChecksUploadedOrders(t *testing.T) {
+	client := &stubAccrualClient{order: &accrual.Order{Status: "PROCESSED", Accrual: 100}}
+	queue := NewOrderQueue(16)
+	storage := newMemoryOrderStorage()
+	lps := NewLoyaltyProcessorService(client, storage, queue)
+
+	lps.Start(context.Background())
+	defer lps.Stop(context.Background())
+
+	order := models.Order{OrderNumber: "12345678903", Status: models.OrderStatusNew}
+	require.NoError(t, queue.OrderStorage(storage).ProcessOrder(context.Background(), order))
+
+	assert.Eventually(t, func() bool {
+		return storage.order(order.OrderNumber).Status == models.OrderStatusProcessed
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+const (
+	outboxRelayBatchSize = 100
+	// outboxRelayLease is how long a relay holds the events it claimed. It
+	// stops publishing after half of it, well before another relay may
+	// claim the same events.
+	outboxRelayLease = time.Minute
+	// outboxRecordTimeout bounds recording the outcome of a batch, which
+	// is done even while the relay is stopping
+	outboxRecordTimeout = 5 * time.Second
+)
+
+type OutboxStorage interface {
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error)
+	MarkOutboxEventsPublished(ctx context.Context, ids []int64) error
+	ReleaseOutboxEvents(ctx context.Context, ids []int64) error
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, event models.OutboxEvent) error
+	Close() error
+}
+
+// OutboxRelay publishes outbox events to the external event bus.
+type OutboxRelay struct {
+	worker
+	OutboxStorage OutboxStorage
+	publisher     Publisher
+}
+
+func NewOutboxRelay(os OutboxStorage, p Publisher) *OutboxRelay {
+	return &OutboxRelay{
+		OutboxStorage: os,
+		publisher:     p,
+	}
+}
+
+func (r *OutboxRelay) relay(ctx context.Context) {
+	for {
+		claimed, published, err := r.relayBatch(ctx)
+		if err != nil {
+			logger.Sugar.Errorf("error relaying outbox events, %d of %d published: %v", published, claimed, err)
+			return
+		}
+		if claimed < outboxRelayBatchSize {
+			return
+		}
+	}
+}
+
+// relayBatch publishes a batch of claimed events in outbox order. It stops at
+// the first failure, so that an event is never published before an earlier
+// one, and releases the events it did not publish.
+func (r *OutboxRelay) relayBatch(ctx context.Context) (int, int, error) {
+	events, err := r.OutboxStorage.ClaimOutboxEvents(ctx, outboxRelayBatchSize, outboxRelayLease)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(events) == 0 {
+		return 0, 0, nil
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, outboxRelayLease/2)
+	defer cancel()
+	published := 0
+	var publishErr error
+	for _, event := range events {
+		if publishErr = r.publisher.Publish(publishCtx, event); publishErr != nil {
+			break
+		}
+		published++
+	}
+
+	ids := make([]int64, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	recordCtx, recordCancel := context.WithTimeout(context.WithoutCancel(ctx), outboxRecordTimeout)
+	defer recordCancel()
+	if published > 0 {
+		if err = r.OutboxStorage.MarkOutboxEventsPublished(recordCtx, ids[:published]); err != nil {
+			return len(events), published, err
+		}
+	}
+	if published < len(events) {
+		if err = r.OutboxStorage.ReleaseOutboxEvents(recordCtx, ids[published:]); err != nil {
+			logger.Sugar.Errorf("error releasing outbox events: %v", err)
+		}
+	}
+	return len(events), published, publishErr
+}
+
+func (r *OutboxRelay) Start(ctx context.Context, interval time.Duration) {
+	r.start(ctx, func(ctx context.Context) {
+		r.Run(ctx, interval)
+	})
+}
+
+// Run relays outbox events every interval until ctx is cancelled.
+func (r *OutboxRelay) Run(ctx context.Context, interval time.Duration) {
+	logger.Sugar.Infoln("Starting outboxRelay")
+	runTicker(ctx, interval, r.relay)
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/evgfitil/gophermart.git/internal/models"
+	"github.com/evgfitil/gophermart.git/internal/publisher"
+)
+
+// memoryOutboxStorage claims unpublished events in order while no claim is
+// held, like the database does.
+type memoryOutboxStorage struct {
+	mu        sync.Mutex
+	events    []models.OutboxEvent
+	published map[int64]bool
+	claimed   map[int64]bool
+}
+
+func newMemoryOutboxStorage(n int) *memoryOutboxStorage {
+	s := &memoryOutboxStorage{published: make(map[int64]bool), claimed: make(map[int64]bool)}
+	for i := 1; i <= n; i++ {
+		s.events = append(s.events, models.OutboxEvent{ID: int64(i), Type: models.OutboxEventOrderUploaded, UserID: 1})
+	}
+	return s
+}
+
+func (s *memoryOutboxStorage) ClaimOutboxEvents(_ context.Context, limit int, _ time.Duration) ([]models.OutboxEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.claimed) > 0 {
+		return nil, nil
+	}
+	var events []models.OutboxEvent
+	for _, event := range s.events {
+		if len(events) == limit {
+			break
+		}
+		if !s.published[event.ID] {
+			s.claimed[event.ID] = true
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (s *memoryOutboxStorage) MarkOutboxEventsPublished(_ context.Context, ids []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		s.published[id] = true
+		delete(s.claimed, id)
+	}
+	return nil
+}
+
+func (s *memoryOutboxStorage) ReleaseOutboxEvents(_ context.Context, ids []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		delete(s.claimed, id)
+	}
+	return nil
+}
+
+// failingPublisher fails to publish the event with id failID.
+type failingPublisher struct {
+	*publisher.MemoryPublisher
+	failID int64
+}
+
+func (fp *failingPublisher) Publish(ctx context.Context, event models.OutboxEvent) error {
+	if event.ID == fp.failID {
+		return errors.New("nats: timeout")
+	}
+	return fp.MemoryPublisher.Publish(ctx, event)
+}
+
+func publishedIDs(mp *publisher.MemoryPublisher) []int64 {
+	var ids []int64
+	for _, message := range mp.Messages() {
+		ids = append(ids, message.ID)
+	}
+	return ids
+}
+
+func TestOutboxRelay(t *testing.T) {
+	tests := []struct {
+		name          string
+		events        int
+		failID        int64
+		wantPublished int
+	}{
+		{name: "nothing to publish", events: 0, wantPublished: 0},
+		{name: "one batch", events: 3, wantPublished: 3},
+		{name: "several batches", events: 2*outboxRelayBatchSize + 5, wantPublished: 2*outboxRelayBatchSize + 5},
+		{name: "stops at the first failure", events: 5, failID: 3, wantPublished: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newMemoryOutboxStorage(tt.events)
+			mp := publisher.NewMemoryPublisher()
+			r := NewOutboxRelay(storage, &failingPublisher{MemoryPublisher: mp, failID: tt.failID})
+
+			r.relay(context.Background())
+
+			ids := publishedIDs(mp)
+			require.Len(t, ids, tt.wantPublished)
+			for i, id := range ids {
+				assert.Equal(t, int64(i+1), id, "events are published in outbox order")
+				assert.True(t, storage.published[id])
+			}
+			assert.Len(t, storage.published, tt.wantPublished)
+			assert.Empty(t, storage.claimed, "unpublished events are released")
+		})
+	}
+}
+
+func TestOutboxRelayRetriesAfterFailure(t *testing.T) {
+	storage := newMemoryOutboxStorage(5)
+	mp := publisher.NewMemoryPublisher()
+	fp := &failingPublisher{MemoryPublisher: mp, failID: 3}
+	r := NewOutboxRelay(storage, fp)
+
+	r.relay(context.Background())
+	fp.failID = 0
+	r.relay(context.Background())
+
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, publishedIDs(mp))
+}
+
+func TestOutboxRelayRun(t *testing.T) {
+	storage := newMemoryOutboxStorage(3)
+	mp := publisher.NewMemoryPublisher()
+	r := NewOutboxRelay(storage, mp)
+
+	r.Start(context.Background(), time.Millisecond)
+	require.Eventually(t, func() bool { return len(mp.Messages()) == 3 }, time.Second, time.Millisecond)
+	require.NoError(t, r.Stop(context.Background()))
+}
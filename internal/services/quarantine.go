@@ -0,0 +1,89 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/evgfitil/gophermart.git/internal/accrual"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+// accrualStatuses maps the statuses of the accrual system to order statuses.
+// An order registered in the accrual system is already being processed from
+// the user's point of view.
+var accrualStatuses = map[string]string{
+	accrual.StatusRegistered: models.OrderStatusProcessing,
+	accrual.StatusProcessing: models.OrderStatusProcessing,
+	accrual.StatusInvalid:    models.OrderStatusInvalid,
+	accrual.StatusProcessed:  models.OrderStatusProcessed,
+}
+
+// accrualAnomaly is an accrual system response that must not be applied to
+// the order.
+type accrualAnomaly struct {
+	reason string
+	detail string
+}
+
+func (a *accrualAnomaly) Error() string {
+	return fmt.Sprintf("accrual response rejected (%s): %s", a.reason, a.detail)
+}
+
+// validateAccrual checks the accrual system response for the order and
+// returns the order status it maps to, or the anomaly found.
+func validateAccrual(number string, result *accrual.Order) (string, *accrualAnomaly) {
+	if result.Number != number {
+		return "", &accrualAnomaly{reason: "order_mismatch", detail: fmt.Sprintf("response is for order %q", result.Number)}
+	}
+	status, ok := accrualStatuses[result.Status]
+	if !ok {
+		return "", &accrualAnomaly{reason: "unknown_status", detail: fmt.Sprintf("status %q", result.Status)}
+	}
+	if math.IsNaN(result.Accrual) || math.IsInf(result.Accrual, 0) || result.Accrual < 0 {
+		return "", &accrualAnomaly{reason: "invalid_accrual", detail: fmt.Sprintf("accrual %v", result.Accrual)}
+	}
+	return status, nil
+}
+
+// quarantine keeps orders with rejected accrual responses out of processing
+// for a period, so that an anomaly is neither applied nor requested again
+// on every run.
+type quarantine struct {
+	period time.Duration
+	now    func() time.Time
+
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+func newQuarantine(period time.Duration) *quarantine {
+	return &quarantine{
+		period: period,
+		now:    time.Now,
+		until:  make(map[string]time.Time),
+	}
+}
+
+func (q *quarantine) Add(number string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.until[number] = q.now().Add(q.period)
+}
+
+// Contains reports whether the order is quarantined and forgets orders whose
+// period has passed.
+func (q *quarantine) Contains(number string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	until, ok := q.until[number]
+	if !ok {
+		return false
+	}
+	if !q.now().Before(until) {
+		delete(q.until, number)
+		return false
+	}
+	return true
+}
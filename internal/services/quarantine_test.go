@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/evgfitil/gophermart.git/internal/accrual"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+func TestValidateAccrual(t *testing.T) {
+	tests := []struct {
+		name       string
+		result     accrual.Order
+		wantStatus string
+		wantReason string
+	}{
+		{
+			name:       "registered",
+			result:     accrual.Order{Number: "12345678903", Status: "REGISTERED"},
+			wantStatus: models.OrderStatusProcessing,
+		},
+		{
+			name:       "processing",
+			result:     accrual.Order{Number: "12345678903", Status: "PROCESSING"},
+			wantStatus: models.OrderStatusProcessing,
+		},
+		{
+			name:       "invalid",
+			result:     accrual.Order{Number: "12345678903", Status: "INVALID"},
+			wantStatus: models.OrderStatusInvalid,
+		},
+		{
+			name:       "processed",
+			result:     accrual.Order{Number: "12345678903", Status: "PROCESSED", Accrual: 500},
+			wantStatus: models.OrderStatusProcessed,
+		},
+		{
+			name:       "processed without accrual",
+			result:     accrual.Order{Number: "12345678903", Status: "PROCESSED"},
+			wantStatus: models.OrderStatusProcessed,
+		},
+		{
+			name:       "other order",
+			result:     accrual.Order{Number: "2377225624", Status: "PROCESSED", Accrual: 500},
+			wantReason: "order_mismatch",
+		},
+		{
+			name:       "empty status",
+			result:     accrual.Order{Number: "12345678903"},
+			wantReason: "unknown_status",
+		},
+		{
+			name:       "unknown status",
+			result:     accrual.Order{Number: "12345678903", Status: "REFUNDED"},
+			wantReason: "unknown_status",
+		},
+		{
+			name:       "negative accrual",
+			result:     accrual.Order{Number: "12345678903", Status: "PROCESSED", Accrual: -1},
+			wantReason: "invalid_accrual",
+		},
+		{
+			name:       "infinite accrual",
+			result:     accrual.Order{Number: "12345678903", Status: "PROCESSED", Accrual: math.Inf(1)},
+			wantReason: "invalid_accrual",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, anomaly := validateAccrual("12345678903", &tt.result)
+			if tt.wantReason != "" {
+				require.NotNil(t, anomaly)
+				assert.Equal(t, tt.wantReason, anomaly.reason)
+				return
+			}
+			require.Nil(t, anomaly)
+			assert.Equal(t, tt.wantStatus, status)
+		})
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	now := time.Now()
+	q := newQuarantine(time.Hour)
+	q.now = func() time.Time { return now }
+
+	q.Add("12345678903")
+	assert.True(t, q.Contains("12345678903"))
+	assert.False(t, q.Contains("2377225624"))
+
+	now = now.Add(time.Hour)
+	assert.False(t, q.Contains("12345678903"))
+}
+
+func TestLoyaltyProcessorQuarantinesAnomalies(t *testing.T) {
+	tests := []struct {
+		name   string
+		client *stubAccrualClient
+	}{
+		{
+			name:   "unknown status",
+			client: &stubAccrualClient{order: &accrual.Order{Status: "REFUNDED"}},
+		},
+		{
+			name:   "negative accrual",
+			client: &stubAccrualClient{order: &accrual.Order{Status: "PROCESSED", Accrual: -100}},
+		},
+		{
+			name: "malformed response",
+			client: &stubAccrualClient{
+				errs:  []error{accrual.ErrMalformedResponse},
+				order: &accrual.Order{Status: "PROCESSED", Accrual: 100},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := models.Order{OrderNumber: "12345678903", Status: models.OrderStatusNew}
+			storage := newMemoryOrderStorage(order)
+			lps := NewLoyaltyProcessorService(tt.client, storage, nil)
+			ctx := context.Background()
+
+			lps.CheckAccrual(ctx, []models.Order{order})
+			assert.Equal(t, models.OrderStatusNew, storage.order(order.OrderNumber).Status)
+			assert.Equal(t, 1, tt.client.calls)
+
+			// a quarantined order is not requested again
+			lps.CheckAccrual(ctx, []models.Order{order})
+			assert.Equal(t, 1, tt.client.calls)
+		})
+	}
+}
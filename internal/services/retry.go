@@ -0,0 +1,26 @@
+package services
+
+import (
+	"math/rand"
+	"time"
+)
+
+// retryPolicy bounds the attempts of a request and the exponential backoff
+// between them.
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// delay returns the backoff after the given failed attempt, starting at 1.
+// The delay doubles up to maxDelay and is jittered between half and all of
+// it, so that retries of several instances spread out.
+func (p retryPolicy) delay(attempt int) time.Duration {
+	delay := p.baseDelay << (attempt - 1)
+	if delay <= 0 || delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
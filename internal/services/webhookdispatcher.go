@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/evgfitil/gophermart.git/internal/logger"
+	"github.com/evgfitil/gophermart.git/internal/models"
+	"github.com/evgfitil/gophermart.git/internal/netguard"
+)
+
+const (
+	webhookFanOutBatchSize  = 100
+	webhookClaimBatchSize   = 20
+	webhookClaimLease       = 5 * time.Minute
+	webhookRequestTimeout   = 10 * time.Second
+	webhookMaxAttempts      = 8
+	webhookBaseRetryDelay   = 30 * time.Second
+	webhookMaxRetryDelay    = time.Hour
+	webhookErrorBodyLimit   = 512
+	webhookSignatureHeader  = "X-Gophermart-Signature"
+	webhookEventHeader      = "X-Gophermart-Event"
+	webhookDeliveryIDHeader = "X-Gophermart-Delivery"
+)
+
+type WebhookStorage interface {
+	FanOutOutboxEvents(ctx context.Context, limit int) (int, error)
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, deliveryID int64, status string, responseStatus int, lastError string, nextAttemptAt time.Time) error
+}
+
+// WebhookDispatcher turns outbox events into webhook deliveries and sends
+// them to the subscribed endpoints.
+type WebhookDispatcher struct {
+	worker
+	WebhookStorage WebhookStorage
+	client         *resty.Client
+}
+
+func NewWebhookDispatcher(ws WebhookStorage) *WebhookDispatcher {
+	// webhook URLs come from users, every connection, including those of
+	// redirects, is checked against the internal network when it is dialled.
+	// A proxy would dial on our behalf, so none is used.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = netguard.DialContext
+	client := resty.NewWithClient(&http.Client{Transport: transport}).SetTimeout(webhookRequestTimeout)
+	return &WebhookDispatcher{
+		WebhookStorage: ws,
+		client:         client,
+	}
+}
+
+// SignWebhookPayload returns the signature header value for body. Receivers
+// recompute the HMAC-SHA256 of "<timestamp>.<body>" with the subscription
+// secret and compare it with v1.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func webhookRetryDelay(attempt int) time.Duration {
+	delay := webhookBaseRetryDelay << attempt
+	if delay <= 0 || delay > webhookMaxRetryDelay {
+		return webhookMaxRetryDelay
+	}
+	return delay
+}
+
+func (wd *WebhookDispatcher) deliver(ctx context.Context, delivery models.WebhookDelivery) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		logger.Sugar.Errorf("error encoding webhook event %d: %v", delivery.Event.ID, err)
+		return
+	}
+
+	var responseStatus int
+	var lastError string
+	resp, err := wd.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetHeader(webhookEventHeader, delivery.Event.Type).
+		SetHeader(webhookDeliveryIDHeader, strconv.FormatInt(delivery.ID, 10)).
+		SetHeader(webhookSignatureHeader, SignWebhookPayload(delivery.Secret, time.Now().Unix(), body)).
+		SetBody(body).
+		Post(delivery.URL)
+	if err != nil {
+		lastError = err.Error()
+	} else {
+		responseStatus = resp.StatusCode()
+		if !resp.IsSuccess() {
+			lastError = string(resp.Body())
+			if len(lastError) > webhookErrorBodyLimit {
+				lastError = lastError[:webhookErrorBodyLimit]
+			}
+		}
+	}
+
+	if ctx.Err() != nil {
+		// the lease expires and the delivery is retried by the next run
+		return
+	}
+
+	status := models.WebhookDeliveryDelivered
+	var nextAttemptAt time.Time
+	if err != nil || !resp.IsSuccess() {
+		attempt := delivery.Attempts + 1
+		if attempt >= webhookMaxAttempts {
+			status = models.WebhookDeliveryFailed
+			logger.Sugar.Warnf("webhook delivery %d failed permanently after %d attempts", delivery.ID, attempt)
+		} else {
+			status = models.WebhookDeliveryPending
+			nextAttemptAt = time.Now().Add(webhookRetryDelay(delivery.Attempts))
+			logger.Sugar.Infof("webhook delivery %d failed, retrying at %v", delivery.ID, nextAttemptAt)
+		}
+	}
+
+	if err = wd.WebhookStorage.RecordWebhookAttempt(ctx, delivery.ID, status, responseStatus, lastError, nextAttemptAt); err != nil {
+		logger.Sugar.Errorf("error recording webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+func (wd *WebhookDispatcher) dispatch(ctx context.Context) {
+	if _, err := wd.WebhookStorage.FanOutOutboxEvents(ctx, webhookFanOutBatchSize); err != nil {
+		logger.Sugar.Errorln("Error fanning out outbox events: ", err)
+	}
+
+	deliveries, err := wd.WebhookStorage.ClaimWebhookDeliveries(ctx, webhookClaimBatchSize, webhookClaimLease)
+	if err != nil {
+		logger.Sugar.Errorln("Error fetching webhook deliveries: ", err)
+		return
+	}
+	for _, delivery := range deliveries {
+		wd.deliver(ctx, delivery)
+	}
+}
+
+func (wd *WebhookDispatcher) Start(ctx context.Context, interval time.Duration) {
+	wd.start(ctx, func(ctx context.Context) {
+		wd.Run(ctx, interval)
+	})
+}
+
+// Run dispatches webhook deliveries every interval until ctx is cancelled.
+func (wd *WebhookDispatcher) Run(ctx context.Context, interval time.Duration) {
+	logger.Sugar.Infoln("Starting webhookDispatcher")
+	runTicker(ctx, interval, wd.dispatch)
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+type webhookAttempt struct {
+	status         string
+	responseStatus int
+	lastError      string
+	nextAttemptAt  time.Time
+}
+
+// memoryWebhookStorage hands out its deliveries once and records the
+// attempts made on them.
+type memoryWebhookStorage struct {
+	mu         sync.Mutex
+	deliveries []models.WebhookDelivery
+	attempts   map[int64]webhookAttempt
+}
+
+func (s *memoryWebhookStorage) FanOutOutboxEvents(_ context.Context, _ int) (int, error) {
+	return 0, nil
+}
+
+func (s *memoryWebhookStorage) ClaimWebhookDeliveries(_ context.Context, limit int, _ time.Duration) ([]models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.deliveries) < limit {
+		limit = len(s.deliveries)
+	}
+	claimed := s.deliveries[:limit]
+	s.deliveries = s.deliveries[limit:]
+	return claimed, nil
+}
+
+func (s *memoryWebhookStorage) RecordWebhookAttempt(_ context.Context, deliveryID int64, status string, responseStatus int, lastError string, nextAttemptAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attempts == nil {
+		s.attempts = make(map[int64]webhookAttempt)
+	}
+	s.attempts[deliveryID] = webhookAttempt{status: status, responseStatus: responseStatus, lastError: lastError, nextAttemptAt: nextAttemptAt}
+	return nil
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(`1700000000.{"id":1}`))
+	want := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      []byte
+		wantEqual bool
+	}{
+		{name: "same payload", secret: "secret", timestamp: 1700000000, body: body, wantEqual: true},
+		{name: "other secret", secret: "other", timestamp: 1700000000, body: body},
+		{name: "other timestamp", secret: "secret", timestamp: 1700000001, body: body},
+		{name: "other body", secret: "secret", timestamp: 1700000000, body: []byte(`{"id":2}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SignWebhookPayload(tt.secret, tt.timestamp, tt.body)
+			assert.Regexp(t, `^t=\d+,v1=[0-9a-f]{64}$`, got)
+			assert.Equal(t, tt.wantEqual, got == want)
+		})
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 0, want: 30 * time.Second},
+		{attempt: 1, want: time.Minute},
+		{attempt: 2, want: 2 * time.Minute},
+		{attempt: 6, want: 32 * time.Minute},
+		{attempt: 7, want: time.Hour},
+		{attempt: 70, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempt), func(t *testing.T) {
+			assert.Equal(t, tt.want, webhookRetryDelay(tt.attempt))
+		})
+	}
+}
+
+func TestWebhookDispatcherDeliver(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string]*http.Request)
+	bodies := make(map[string][]byte)
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		mu.Lock()
+		received[req.URL.Path] = req
+		bodies[req.URL.Path] = body
+		mu.Unlock()
+		if req.URL.Path == "/broken" {
+			http.Error(res, strings.Repeat("x", 2*webhookErrorBodyLimit), http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	event := models.OutboxEvent{ID: 5, Type: models.OutboxEventOrderProcessed, Payload: json.RawMessage(`{"number":"12345678903"}`)}
+	tests := []struct {
+		name           string
+		path           string
+		attempts       int
+		wantStatus     string
+		wantResponse   int
+		wantRetryAfter time.Duration
+	}{
+		{name: "delivered", path: "/ok", wantStatus: models.WebhookDeliveryDelivered, wantResponse: http.StatusOK},
+		{name: "first failure", path: "/broken", wantStatus: models.WebhookDeliveryPending, wantResponse: http.StatusInternalServerError, wantRetryAfter: 30 * time.Second},
+		{name: "later failure", path: "/broken", attempts: 3, wantStatus: models.WebhookDeliveryPending, wantResponse: http.StatusInternalServerError, wantRetryAfter: 4 * time.Minute},
+		{name: "last attempt", path: "/broken", attempts: webhookMaxAttempts - 1, wantStatus: models.WebhookDeliveryFailed, wantResponse: http.StatusInternalServerError},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &memoryWebhookStorage{}
+			wd := NewWebhookDispatcher(storage)
+			// the test server listens on loopback, which the dispatcher refuses
+			wd.client = resty.New()
+
+			delivery := models.WebhookDelivery{ID: int64(i + 1), URL: ts.URL + tt.path, Secret: "secret", Event: event, Attempts: tt.attempts}
+			start := time.Now()
+			wd.deliver(context.Background(), delivery)
+
+			attempt := storage.attempts[delivery.ID]
+			assert.Equal(t, tt.wantStatus, attempt.status)
+			assert.Equal(t, tt.wantResponse, attempt.responseStatus)
+			if tt.wantStatus == models.WebhookDeliveryDelivered {
+				assert.Empty(t, attempt.lastError)
+			} else {
+				assert.Len(t, attempt.lastError, webhookErrorBodyLimit)
+			}
+			if tt.wantRetryAfter > 0 {
+				assert.WithinDuration(t, start.Add(tt.wantRetryAfter), attempt.nextAttemptAt, time.Second)
+			} else {
+				assert.True(t, attempt.nextAttemptAt.IsZero())
+			}
+
+			mu.Lock()
+			req, body := received[tt.path], bodies[tt.path]
+			mu.Unlock()
+			require.NotNil(t, req)
+			assert.Equal(t, models.OutboxEventOrderProcessed, req.Header.Get(webhookEventHeader))
+			assert.Equal(t, strconv.FormatInt(delivery.ID, 10), req.Header.Get(webhookDeliveryIDHeader))
+			signature := req.Header.Get(webhookSignatureHeader)
+			timestamp, err := strconv.ParseInt(strings.TrimPrefix(strings.Split(signature, ",")[0], "t="), 10, 64)
+			require.NoError(t, err)
+			assert.Equal(t, SignWebhookPayload("secret", timestamp, body), signature)
+		})
+	}
+}
+
+func TestWebhookDispatcherRefusesInternalAddresses(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		t.Error("a loopback endpoint must not be reached")
+	}))
+	defer ts.Close()
+
+	storage := &memoryWebhookStorage{deliveries: []models.WebhookDelivery{{ID: 1, URL: ts.URL, Secret: "secret"}}}
+	wd := NewWebhookDispatcher(storage)
+	wd.dispatch(context.Background())
+
+	attempt := storage.attempts[1]
+	assert.Equal(t, models.WebhookDeliveryPending, attempt.status)
+	assert.Contains(t, attempt.lastError, "not publicly routable")
+}
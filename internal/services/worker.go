@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// worker runs the background loop of a service and lets the owner stop it.
+type worker struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (w *worker) start(ctx context.Context, loop func(ctx context.Context)) {
+	ctx, w.cancel = context.WithCancel(ctx)
+	w.done = make(chan struct{})
+	go func() {
+		defer close(w.done)
+		loop(ctx)
+	}()
+}
+
+// runTicker calls tick every interval until ctx is cancelled.
+func runTicker(ctx context.Context, interval time.Duration, tick func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tick(ctx)
+		}
+	}
+}
+
+// Stop cancels the loop and waits for the iteration in progress to finish or
+// for ctx to expire, whichever comes first.
+func (w *worker) Stop(ctx context.Context) error {
+	if w.cancel == nil {
+		return nil
+	}
+	w.cancel()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sleep pauses for d or until ctx is cancelled.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerStop(t *testing.T) {
+	tests := []struct {
+		name string
+		// cleanup is how long the loop keeps running once it is cancelled
+		cleanup time.Duration
+		timeout time.Duration
+		wantErr error
+	}{
+		{name: "loop returns at once", timeout: time.Second},
+		{name: "waits for the loop", cleanup: 20 * time.Millisecond, timeout: time.Second},
+		{name: "deadline passes", cleanup: time.Second, timeout: 10 * time.Millisecond, wantErr: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w worker
+			var cancelled, finished atomic.Bool
+			release := make(chan struct{})
+			defer close(release)
+			w.start(context.Background(), func(ctx context.Context) {
+				<-ctx.Done()
+				cancelled.Store(true)
+				select {
+				case <-time.After(tt.cleanup):
+				case <-release:
+				}
+				finished.Store(true)
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			err := w.Stop(ctx)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Eventually(t, cancelled.Load, time.Second, time.Millisecond, "Stop cancels the loop")
+				assert.False(t, finished.Load())
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, cancelled.Load(), "Stop cancels the loop")
+			assert.True(t, finished.Load(), "Stop waits for the loop to return")
+		})
+	}
+}
+
+func TestWorkerStopNotStarted(t *testing.T) {
+	var w worker
+	assert.NoError(t, w.Stop(context.Background()))
+}
+
+func TestRunTicker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var ticks atomic.Int32
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runTicker(ctx, time.Millisecond, func(context.Context) {
+			ticks.Add(1)
+		})
+	}()
+
+	require.Eventually(t, func() bool { return ticks.Load() >= 3 }, time.Second, time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("runTicker did not return after ctx was cancelled")
+	}
+}
+
+func TestSleep(t *testing.T) {
+	assert.NoError(t, sleep(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, sleep(ctx, time.Hour), context.Canceled)
+}
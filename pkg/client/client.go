@@ -0,0 +1,270 @@
+// Package client is a Go client for the gophermart HTTP API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxErrorBodySize = 64 << 10
+)
+
+// Order statuses.
+const (
+	OrderStatusNew        = "NEW"
+	OrderStatusProcessing = "PROCESSING"
+	OrderStatusInvalid    = "INVALID"
+	OrderStatusProcessed  = "PROCESSED"
+)
+
+type Order struct {
+	Number     string    `json:"number"`
+	Status     string    `json:"status"`
+	Accrual    float64   `json:"accrual,omitempty"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+type Balance struct {
+	Current   float64 `json:"current"`
+	Withdrawn float64 `json:"withdrawn"`
+}
+
+type Withdrawal struct {
+	Order       string    `json:"order"`
+	Sum         float64   `json:"sum"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+type credentials struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+type withdrawRequest struct {
+	Order string  `json:"order"`
+	Sum   float64 `json:"sum"`
+}
+
+type problem struct {
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+	Code   string `json:"code"`
+}
+
+// Client calls the API on behalf of one user. It keeps the token returned
+// by Register or Login and, when the server rejects it, logs in again with
+// the same credentials and retries the request once. A Client is safe for
+// concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	token    string
+	login    string
+	password string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests, http.DefaultClient
+// by default.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// New returns a client for the API at baseURL, e.g. "http://localhost:8080".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Register creates a user and authenticates the client as that user.
+func (c *Client) Register(ctx context.Context, login, password string) error {
+	return c.authenticate(ctx, "/api/user/register", login, password)
+}
+
+// Login authenticates the client as an existing user.
+func (c *Client) Login(ctx context.Context, login, password string) error {
+	return c.authenticate(ctx, "/api/user/login", login, password)
+}
+
+// UploadOrder submits an order number for accrual. It reports false if the
+// user had already uploaded the order.
+func (c *Client) UploadOrder(ctx context.Context, number string) (bool, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/api/user/orders", "text/plain", []byte(number))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusAccepted:
+		return true, nil
+	case http.StatusOK:
+		return false, nil
+	default:
+		return false, readError(resp)
+	}
+}
+
+// Orders returns the user's orders, newest first.
+func (c *Client) Orders(ctx context.Context) ([]Order, error) {
+	var orders []Order
+	if err := c.getJSON(ctx, "/api/user/orders", &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (c *Client) Balance(ctx context.Context) (Balance, error) {
+	var balance Balance
+	if err := c.getJSON(ctx, "/api/user/balance", &balance); err != nil {
+		return Balance{}, err
+	}
+	return balance, nil
+}
+
+// Withdraw spends sum points on the order with the given number.
+func (c *Client) Withdraw(ctx context.Context, order string, sum float64) error {
+	body, err := json.Marshal(withdrawRequest{Order: order, Sum: sum})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/api/user/balance/withdraw", "application/json", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+	return nil
+}
+
+func (c *Client) Withdrawals(ctx context.Context) ([]Withdrawal, error) {
+	var withdrawals []Withdrawal
+	if err := c.getJSON(ctx, "/api/user/withdrawals", &withdrawals); err != nil {
+		return nil, err
+	}
+	return withdrawals, nil
+}
+
+func (c *Client) authenticate(ctx context.Context, path, login, password string) error {
+	body, err := json.Marshal(credentials{Login: login, Password: password})
+	if err != nil {
+		return err
+	}
+	resp, err := c.send(ctx, http.MethodPost, path, "application/json", body, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+	token := resp.Header.Get("Authorization")
+	if token == "" {
+		return errors.New("gophermart: no token in the response")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+	c.login = login
+	c.password = password
+	return nil
+}
+
+// getJSON decodes a successful response into v and leaves v untouched on
+// 204 No Content.
+func (c *Client) getJSON(ctx context.Context, path string, v any) error {
+	resp, err := c.do(ctx, http.MethodGet, path, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return fmt.Errorf("gophermart: error decoding response: %w", err)
+		}
+		return nil
+	case http.StatusNoContent:
+		return nil
+	default:
+		return readError(resp)
+	}
+}
+
+// do sends an authenticated request. If the token is rejected and the
+// client knows the credentials it logs in again and resends the request.
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte) (*http.Response, error) {
+	c.mu.Lock()
+	token, login, password := c.token, c.login, c.password
+	c.mu.Unlock()
+
+	resp, err := c.send(ctx, method, path, contentType, body, token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || login == "" {
+		return resp, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBodySize))
+	resp.Body.Close()
+
+	if err = c.Login(ctx, login, password); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	token = c.token
+	c.mu.Unlock()
+	return c.send(ctx, method, path, contentType, body, token)
+}
+
+func (c *Client) send(ctx context.Context, method, path, contentType string, body []byte, token string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	return c.httpClient.Do(req)
+}
+
+// readError turns an error response into an APIError. Bodies that are not
+// problem documents only contribute the status code.
+func readError(resp *http.Response) error {
+	var p problem
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err == nil {
+		json.Unmarshal(data, &p)
+	}
+	return newAPIError(resp, p)
+}
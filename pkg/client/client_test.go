@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/evgfitil/gophermart.git/internal/api"
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+	"github.com/evgfitil/gophermart.git/internal/mocks"
+	"github.com/evgfitil/gophermart.git/internal/models"
+)
+
+type testServer struct {
+	url      string
+	orders   *mocks.MockOrderStorage
+	users    *mocks.MockUserStorage
+	balances *mocks.MockBalanceStorage
+}
+
+func newTestServer(t *testing.T) *testServer {
+	ctrl := gomock.NewController(t)
+	s := &testServer{
+		orders:   mocks.NewMockOrderStorage(ctrl),
+		users:    mocks.NewMockUserStorage(ctrl),
+		balances: mocks.NewMockBalanceStorage(ctrl),
+	}
+	router := api.Router(api.Dependencies{Orders: s.orders, Users: s.users, Balances: s.balances})
+	ts := httptest.NewServer(router)
+	t.Cleanup(ts.Close)
+	s.url = ts.URL
+	return s
+}
+
+func (s *testServer) expectLogin(t *testing.T, login, password string) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	s.users.EXPECT().GetUserByUsername(gomock.Any(), login).Return(string(hash), nil)
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	c := New(s.url)
+
+	s.users.EXPECT().IsUserUnique(gomock.Any(), "user").Return(true, nil)
+	s.users.EXPECT().CreateUser(gomock.Any(), "user", gomock.Any()).Return(nil)
+	require.NoError(t, c.Register(ctx, "user", "secret"))
+
+	s.users.EXPECT().GetUserID(gomock.Any(), "user").Return(1, nil).AnyTimes()
+	s.balances.EXPECT().GetUserID(gomock.Any(), "user").Return(1, nil).AnyTimes()
+
+	s.orders.EXPECT().ProcessOrder(gomock.Any(), gomock.Any()).Return(nil)
+	accepted, err := c.UploadOrder(ctx, "12345678903")
+	require.NoError(t, err)
+	assert.True(t, accepted)
+
+	s.orders.EXPECT().ProcessOrder(gomock.Any(), gomock.Any()).Return(apperrors.ErrOrderAlreadyExists)
+	accepted, err = c.UploadOrder(ctx, "12345678903")
+	require.NoError(t, err)
+	assert.False(t, accepted)
+
+	uploadedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.orders.EXPECT().GetOrders(gomock.Any(), 1).Return([]models.Order{
+		{OrderNumber: "12345678903", Status: OrderStatusProcessed, Accrual: 500, UploadedAt: uploadedAt},
+	}, nil)
+	orders, err := c.Orders(ctx)
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, "12345678903", orders[0].Number)
+	assert.Equal(t, OrderStatusProcessed, orders[0].Status)
+	assert.Equal(t, 500.0, orders[0].Accrual)
+	assert.True(t, uploadedAt.Equal(orders[0].UploadedAt))
+
+	s.orders.EXPECT().GetOrders(gomock.Any(), 1).Return(nil, nil)
+	orders, err = c.Orders(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, orders)
+
+	s.balances.EXPECT().GetUserBalance(gomock.Any(), 1).Return(&models.Balance{Current: 500, Withdrawn: 0}, nil)
+	balance, err := c.Balance(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Balance{Current: 500}, balance)
+
+	s.balances.EXPECT().WithdrawUserBalance(gomock.Any(), gomock.Any()).Return(nil)
+	require.NoError(t, c.Withdraw(ctx, "2377225624", 100))
+
+	s.balances.EXPECT().GetWithdrawals(gomock.Any(), 1).Return([]models.Withdrawal{
+		{OrderNumber: "2377225624", Amount: 100, CreatedAt: uploadedAt},
+	}, nil)
+	withdrawals, err := c.Withdrawals(ctx)
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 1)
+	assert.Equal(t, "2377225624", withdrawals[0].Order)
+	assert.Equal(t, 100.0, withdrawals[0].Sum)
+}
+
+func TestClientErrors(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		call    func(c *Client, s *testServer) error
+		wantErr error
+	}{
+		{
+			name: "user already exists",
+			call: func(c *Client, s *testServer) error {
+				s.users.EXPECT().IsUserUnique(gomock.Any(), "user").Return(false, nil)
+				return c.Register(ctx, "user", "secret")
+			},
+			wantErr: ErrUserAlreadyExists,
+		},
+		{
+			name: "invalid credentials",
+			call: func(c *Client, s *testServer) error {
+				s.users.EXPECT().GetUserByUsername(gomock.Any(), "user").Return("", sql.ErrNoRows)
+				return c.Login(ctx, "user", "secret")
+			},
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name: "not logged in",
+			call: func(c *Client, s *testServer) error {
+				_, err := c.Balance(ctx)
+				return err
+			},
+			wantErr: ErrUnauthorized,
+		},
+		{
+			name: "invalid order number",
+			call: func(c *Client, s *testServer) error {
+				s.expectLogin(t, "user", "secret")
+				require.NoError(t, c.Login(ctx, "user", "secret"))
+				_, err := c.UploadOrder(ctx, "12345")
+				return err
+			},
+			wantErr: ErrInvalidOrderNumber,
+		},
+		{
+			name: "order number taken",
+			call: func(c *Client, s *testServer) error {
+				s.expectLogin(t, "user", "secret")
+				require.NoError(t, c.Login(ctx, "user", "secret"))
+				s.users.EXPECT().GetUserID(gomock.Any(), "user").Return(1, nil)
+				s.orders.EXPECT().ProcessOrder(gomock.Any(), gomock.Any()).Return(apperrors.ErrOrderNumberTaken)
+				_, err := c.UploadOrder(ctx, "12345678903")
+				return err
+			},
+			wantErr: ErrOrderNumberTaken,
+		},
+		{
+			name: "insufficient funds",
+			call: func(c *Client, s *testServer) error {
+				s.expectLogin(t, "user", "secret")
+				require.NoError(t, c.Login(ctx, "user", "secret"))
+				s.balances.EXPECT().GetUserID(gomock.Any(), "user").Return(1, nil)
+				s.balances.EXPECT().WithdrawUserBalance(gomock.Any(), gomock.Any()).Return(apperrors.ErrInsufficientFunds)
+				return c.Withdraw(ctx, "2377225624", 1000)
+			},
+			wantErr: ErrInsufficientFunds,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			err := tt.call(New(s.url), s)
+			require.Error(t, err)
+			assert.ErrorIs(t, err, tt.wantErr)
+
+			var apiErr *APIError
+			require.True(t, errors.As(err, &apiErr))
+			assert.NotZero(t, apiErr.StatusCode)
+		})
+	}
+}
+
+func TestClientRefreshesToken(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	c := New(s.url)
+
+	s.expectLogin(t, "user", "secret")
+	require.NoError(t, c.Login(ctx, "user", "secret"))
+
+	// the server rejects the stored token, e.g. after it expired
+	c.token = "Bearer expired"
+	s.expectLogin(t, "user", "secret")
+	s.balances.EXPECT().GetUserID(gomock.Any(), "user").Return(1, nil)
+	s.balances.EXPECT().GetUserBalance(gomock.Any(), 1).Return(&models.Balance{Current: 42}, nil)
+
+	balance, err := c.Balance(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 42.0, balance.Current)
+	assert.NotEqual(t, "Bearer expired", c.token)
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/evgfitil/gophermart.git/internal/apperrors"
+)
+
+// Errors reported by the API. They are the server's own errors, so
+// errors.Is works the same on both sides.
+var (
+	ErrInvalidRequest           = apperrors.ErrInvalidRequest
+	ErrUnauthorized             = apperrors.ErrUnauthorized
+	ErrInvalidCredentials       = apperrors.ErrInvalidCredentials
+	ErrUserAlreadyExists        = apperrors.ErrUserAlreadyExists
+	ErrInvalidOrderNumber       = apperrors.ErrInvalidOrderNumber
+	ErrOrderNumberTaken         = apperrors.ErrOrderNumberTaken
+	ErrInsufficientFunds        = apperrors.ErrInsufficientFunds
+	ErrIdempotencyKeyReused     = apperrors.ErrIdempotencyKeyReused
+	ErrIdempotencyKeyInProgress = apperrors.ErrIdempotencyKeyInProgress
+	ErrRateLimited              = apperrors.ErrRateLimited
+	ErrRequestTooLarge          = apperrors.ErrRequestTooLarge
+	ErrUnsupportedMediaType     = apperrors.ErrUnsupportedMediaType
+	ErrNotFound                 = apperrors.ErrNotFound
+)
+
+// problemErrors maps the problem codes of the API to errors.
+var problemErrors = map[string]error{
+	"invalid_request":             ErrInvalidRequest,
+	"unauthorized":                ErrUnauthorized,
+	"invalid_credentials":         ErrInvalidCredentials,
+	"user_already_exists":         ErrUserAlreadyExists,
+	"invalid_order_number":        ErrInvalidOrderNumber,
+	"order_number_taken":          ErrOrderNumberTaken,
+	"insufficient_funds":          ErrInsufficientFunds,
+	"idempotency_key_reused":      ErrIdempotencyKeyReused,
+	"idempotency_key_in_progress": ErrIdempotencyKeyInProgress,
+	"rate_limited":                ErrRateLimited,
+	"request_too_large":           ErrRequestTooLarge,
+	"unsupported_media_type":      ErrUnsupportedMediaType,
+	"not_found":                   ErrNotFound,
+}
+
+// APIError is a non-successful response. It unwraps to one of the Err
+// variables when the server reported a known problem code.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Title      string
+	Detail     string
+}
+
+func (e *APIError) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("gophermart: %d %s: %s", e.StatusCode, e.Title, e.Detail)
+	}
+	return fmt.Sprintf("gophermart: %d %s", e.StatusCode, e.Title)
+}
+
+func (e *APIError) Unwrap() error {
+	return problemErrors[e.Code]
+}
+
+func newAPIError(resp *http.Response, p problem) *APIError {
+	title := p.Title
+	if title == "" {
+		title = http.StatusText(resp.StatusCode)
+	}
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Code:       p.Code,
+		Title:      title,
+		Detail:     p.Detail,
+	}
+}